@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// mount point of the cgroup v2 hierarchy, empty if there is none;
+// read on first use
+var cgroup2Mount = sync.OnceValue(func() string {
+	contents, err := os.ReadFile(procDir + "/self/mountinfo")
+	if err != nil {
+		return ""
+	}
+	for _, line := range strings.Split(string(contents), "\n") {
+		// optional fields end with a single "-", followed by the filesystem type
+		before, after, found := strings.Cut(line, " - ")
+		fields := strings.Fields(before)
+		if found && len(fields) >= 5 && strings.HasPrefix(after, "cgroup2 ") {
+			return fields[4]
+		}
+	}
+	return ""
+})
+
+// path of the cgroup v2 the process belongs to, relative to the hierarchy root
+func readCgroupPath(pid int) (string, error) {
+	contents, err := os.ReadFile(fmt.Sprintf("%s/%d/cgroup", procDir, pid))
+	if err != nil {
+		return "", err
+	}
+	for _, line := range strings.Split(string(contents), "\n") {
+		if cgroup, found := strings.CutPrefix(line, "0::"); found {
+			return cgroup, nil
+		}
+	}
+	return "", fmt.Errorf("PID %d is not in a cgroup v2 hierarchy", pid)
+}
+
+// the systemd unit (service or scope) a cgroup belongs to,
+// or the cgroup itself outside of units
+func cgroupUnit(cgroup string) string {
+	if cgroup == "" {
+		return "unknown"
+	}
+	parts := strings.Split(cgroup, "/")
+	for i := len(parts) - 1; i >= 0; i-- {
+		if strings.HasSuffix(parts[i], ".service") || strings.HasSuffix(parts[i], ".scope") {
+			return parts[i]
+		}
+	}
+	return cgroup
+}
+
+// memory usage and the effective limit of a cgroup, in KiB
+type CgroupMemory struct {
+	current int // memory.current of the cgroup itself
+	// the tightest memory.max of the cgroup and its ancestors,
+	// and the headroom left under it
+	limit    int
+	headroom int
+	limited  bool
+}
+
+// reads a cgroup interface file with a single value, "max" meaning unlimited
+func readCgroupValue(cgroup string, name string) (int, bool) {
+	contents, err := os.ReadFile(path.Join(cgroup2Mount(), cgroup, name))
+	if err != nil {
+		return 0, false
+	}
+	value, err := strconv.ParseInt(strings.TrimSpace(string(contents)), 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return int(value / 1024), true
+}
+
+var (
+	cgroupMemoryCache      = map[string]CgroupMemory{}
+	cgroupMemoryCacheMutex = sync.RWMutex{}
+)
+
+// reads usage and limits of a cgroup, walking up to the root,
+// since a limit on any ancestor applies as well
+func readCgroupMemory(cgroup string) CgroupMemory {
+	cgroupMemoryCacheMutex.RLock()
+	cached, ok := cgroupMemoryCache[cgroup]
+	cgroupMemoryCacheMutex.RUnlock()
+	if ok {
+		return cached
+	}
+
+	memory := CgroupMemory{headroom: math.MaxInt}
+	memory.current, _ = readCgroupValue(cgroup, "memory.current")
+	for dir := cgroup; cgroup2Mount() != ""; dir = path.Dir(dir) {
+		limit, limited := readCgroupValue(dir, "memory.max")
+		current, _ := readCgroupValue(dir, "memory.current")
+		if limited && limit-current < memory.headroom {
+			memory.limit = limit
+			memory.headroom = max(limit-current, 0)
+			memory.limited = true
+		}
+		if dir == "/" || dir == "." {
+			break
+		}
+	}
+
+	cgroupMemoryCacheMutex.Lock()
+	cgroupMemoryCache[cgroup] = memory
+	cgroupMemoryCacheMutex.Unlock()
+	return memory
+}
+
+// forgets cgroup usage read so far, before sampling again
+func resetCgroupMemory() {
+	cgroupMemoryCacheMutex.Lock()
+	clear(cgroupMemoryCache)
+	cgroupMemoryCacheMutex.Unlock()
+}
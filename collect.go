@@ -0,0 +1,345 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// Process holds everything collected for a single PID
+type Process struct {
+	pid     int
+	stat    ProcStat
+	status  ProcStatus
+	rollup  SmemRollup
+	owner   PidOwner
+	argv    []string
+	cmdline string // argv separated by spaces
+	tasks   []Task
+	// memory mappings, only collected if requested
+	mappings []Mapping
+	// resident page frames, only kept if requested
+	frames PageFrames
+	// working set, only sampled if requested
+	idle IdleStats
+	// NUMA placement, only collected if requested
+	numa NumaInfo
+	// OOM scores and cgroup memory, only collected if requested
+	oom OOMInfo
+	// collection did not finish before the deadline, only some fields are set
+	incomplete bool
+	err        error
+}
+
+func (p Process) PID() int {
+	return p.pid
+}
+
+func (p Process) State() string {
+	return p.stat.state
+}
+
+func (p Process) Threads() int {
+	return p.status.threads
+}
+
+func (p Process) USS() int {
+	return p.rollup.USS()
+}
+
+func (p Process) PSS() int {
+	return p.rollup.PSS()
+}
+
+func (p Process) RSS() int {
+	return p.rollup.RSS()
+}
+
+func (p Process) Swap() int {
+	return p.rollup.Swap()
+}
+
+// username of the process owner, or uid if it can't be resolved
+func (p Process) User() string {
+	if p.owner.username == "" {
+		return strconv.Itoa(p.owner.uid)
+	}
+	return p.owner.username
+}
+
+// command line, or the command name in brackets (like ps does)
+// for processes without one, e.g. kernel threads and zombies
+func (p Process) Command() string {
+	if p.stat.isZombie() {
+		return "[" + p.stat.comm + "] <defunct>"
+	}
+	if p.cmdline == "" && p.stat.comm != "" {
+		return "[" + p.stat.comm + "]"
+	}
+	return p.cmdline
+}
+
+// returned when a PID exits or is reused while its data is being collected
+var errPidReused = errors.New("process changed during collection")
+
+// opens a pidfd referring to the process, or returns -1 if pidfd_open
+// is not available (Linux < 5.3) or the process is already gone
+func openPidfd(pid int) int {
+	fd, err := unix.PidfdOpen(pid, 0)
+	if err != nil {
+		return -1
+	}
+	return fd
+}
+
+// reports whether the process referred to by pidfd is still alive;
+// EPERM means we may not signal it, but it does exist
+func pidfdAlive(pidfd int) bool {
+	err := unix.PidfdSendSignal(pidfd, 0, nil, 0)
+	return err == nil || errors.Is(err, unix.EPERM)
+}
+
+// runs read in its own goroutine, so that a read blocked in the kernel
+// (e.g. on a process in D state or one holding mmap_lock) can be abandoned
+// when ctx is done; the blocked goroutine is left behind
+func readWithContext[T any](ctx context.Context, read func() (T, error)) (T, error) {
+	if ctx.Done() == nil {
+		return read()
+	}
+	if err := ctx.Err(); err != nil {
+		var zero T
+		return zero, err
+	}
+
+	type result struct {
+		value T
+		err   error
+	}
+	ch := make(chan result, 1)
+	go func() {
+		value, err := read()
+		ch <- result{value, err}
+	}()
+
+	select {
+	case r := <-ch:
+		return r.value, r.err
+	case <-ctx.Done():
+		var zero T
+		return zero, ctx.Err()
+	}
+}
+
+func isContextError(err error) bool {
+	return errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled)
+}
+
+// what to collect and how
+type CollectOptions struct {
+	jobs    int           // number of workers
+	timeout time.Duration // per-PID deadline, no deadline if zero
+	tasks   bool          // list the tasks (threads) of each process
+	// keep processes without memory maps (kernel threads and zombies)
+	allTasks bool
+	mappings bool // read /proc/PID/smaps for per-mapping stats
+	// if set, replace rollup USS, PSS and RSS with exact values from pagemap
+	exact      *KPages
+	keepFrames bool // keep the page frames of each process, requires exact
+	numa       bool // read /proc/PID/numa_maps
+	oom        bool // read OOM scores and cgroup memory limits
+}
+
+// collects all data for one PID in a single pass
+//
+// The start time of the process is read before and after collection,
+// and a pidfd (where available) pins the process for the duration,
+// so data from a PID that exits and is reused mid-read is discarded
+// instead of mixing two different processes in one row.
+//
+// If ctx is done before all data is read, the fields collected so far
+// are returned in a Process marked incomplete.
+func collectProcess(ctx context.Context, pid int, options CollectOptions) Process {
+	pidfd := openPidfd(pid)
+	if pidfd >= 0 {
+		defer unix.Close(pidfd)
+	}
+
+	process := Process{pid: pid, owner: PidOwner{pid, -1, ""}}
+	incomplete := func() Process {
+		process.incomplete = true
+		return process
+	}
+
+	// without a stat the process is gone, so such rows are dropped;
+	// one that did not finish in time is still shown by its PID
+	before, err := readWithContext(ctx, func() (ProcStat, error) { return readProcStat(pid) })
+	if isContextError(err) {
+		return incomplete()
+	} else if err != nil {
+		process.err = err
+		return process
+	}
+	process.stat = before
+
+	owner, err := readWithContext(ctx, func() (PidOwner, error) { return readPidOwner(pid) })
+	if isContextError(err) {
+		return incomplete()
+	} else if err == nil {
+		process.owner = owner
+	}
+
+	status, err := readWithContext(ctx, func() (ProcStatus, error) { return readProcStatus(pid) })
+	if isContextError(err) {
+		return incomplete()
+	} else if err == nil {
+		process.status = status
+	}
+
+	// kernel threads and zombies have no memory maps,
+	// they are kept with zero memory if all tasks are requested;
+	// other processes whose maps can't be read (e.g. EACCES) are dropped
+	contents, err := readWithContext(ctx, func() (string, error) { return readSmapsRollup(pid) })
+	if isContextError(err) {
+		return incomplete()
+	} else if err == nil {
+		process.rollup = parseSmapsRollup(pid, contents)
+	} else if !options.allTasks || !(before.isKernelThread() || before.isZombie()) {
+		process.err = err
+		return process
+	}
+
+	// processes without a command line (e.g. zombies) are still reported
+	argv, err := readWithContext(ctx, func() ([]string, error) { return readArgv(pid) })
+	if isContextError(err) {
+		return incomplete()
+	}
+	process.argv = argv
+	process.cmdline = strings.Join(argv, " ")
+
+	if options.exact != nil && len(process.rollup.stats) > 0 {
+		frames, err := readWithContext(ctx, func() (PageFrames, error) { return readPageFrames(pid) })
+		if isContextError(err) {
+			return incomplete()
+		} else if err != nil {
+			process.err = err
+			return process
+		}
+		accounting, err := options.exact.account(frames)
+		if err != nil {
+			process.err = err
+			return process
+		}
+		process.rollup.stats = accounting.apply(process.rollup.stats)
+		if options.keepFrames {
+			process.frames = frames
+		}
+	}
+
+	if options.numa && len(process.rollup.stats) > 0 {
+		numa, err := readWithContext(ctx, func() (NumaInfo, error) { return readNumaMaps(pid) })
+		if isContextError(err) {
+			return incomplete()
+		} else if err == nil {
+			process.numa = numa
+		}
+	}
+
+	if options.oom {
+		oom, err := readWithContext(ctx, func() (OOMInfo, error) { return readOOMInfo(pid) })
+		if isContextError(err) {
+			return incomplete()
+		} else if err == nil {
+			process.oom = oom
+		}
+	}
+
+	if options.mappings && len(process.rollup.stats) > 0 {
+		contents, err := readWithContext(ctx, func() (string, error) { return readSmaps(pid) })
+		if isContextError(err) {
+			return incomplete()
+		} else if err == nil {
+			process.mappings = parseSmaps(contents)
+		}
+	}
+
+	if options.tasks {
+		tasks, err := readWithContext(ctx, func() ([]Task, error) { return readTasks(pid) })
+		if isContextError(err) {
+			return incomplete()
+		}
+		process.tasks = tasks
+	}
+
+	after, err := readWithContext(ctx, func() (ProcStat, error) { return readProcStat(pid) })
+	if isContextError(err) {
+		return incomplete()
+	} else if err != nil || after.startTime != before.startTime ||
+		(pidfd >= 0 && !pidfdAlive(pidfd)) {
+		process.err = fmt.Errorf("PID %d: %w", pid, errPidReused)
+		return process
+	}
+	process.stat = after
+
+	return process
+}
+
+// worker: collects PIDs from the queue until it is closed,
+// giving each PID at most options.timeout (if > 0) to finish
+func collector(ctx context.Context, options CollectOptions, queue <-chan int, results chan<- Process, wg *sync.WaitGroup) {
+	defer wg.Done()
+	for pid := range queue {
+		// PIDs not started before ctx is done are left out
+		if ctx.Err() != nil {
+			continue
+		}
+		pidCtx, cancel := ctx, context.CancelFunc(func() {})
+		if options.timeout > 0 {
+			pidCtx, cancel = context.WithTimeout(ctx, options.timeout)
+		}
+		results <- collectProcess(pidCtx, pid, options)
+		cancel()
+	}
+}
+
+// collects data for all pids using a pool of options.jobs workers,
+// processes that could not be read are left out,
+// processes that timed out or were cancelled are marked incomplete,
+// and those not started before ctx is done are left out
+func collectProcesses(ctx context.Context, pids []int, options CollectOptions) []Process {
+	jobs := max(options.jobs, 1)
+
+	queue := make(chan int)
+	results := make(chan Process, jobs)
+
+	var wg sync.WaitGroup
+	for range jobs {
+		wg.Add(1)
+		go collector(ctx, options, queue, results, &wg)
+	}
+
+	go func() {
+		for _, pid := range pids {
+			queue <- pid
+		}
+		close(queue)
+	}()
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	processes := make([]Process, 0, len(pids))
+	for process := range results {
+		if process.incomplete || (process.err == nil && (options.allTasks || len(process.rollup.stats) > 0)) {
+			processes = append(processes, process)
+		}
+	}
+	return processes
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"reflect"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The dispatcher replaced by the worker pool, kept to benchmark against:
+// a reader and a parser goroutine per PID for smaps_rollup, and a goroutine
+// per PID for its owner and command line, each with its own channel, the
+// rollups reduced with reflect.Select.
+
+type smemRollupRaw struct {
+	pid      int
+	contents string
+	err      error
+}
+
+type pidOwnerResult struct {
+	owner PidOwner
+	err   error
+}
+
+type argvResult struct {
+	pid  int
+	argv []string
+	err  error
+}
+
+func dispatchSmemRollupParsers(pids []int) map[int]chan SmemRollup {
+	channels := map[int]chan SmemRollup{}
+	for _, pid := range pids {
+		raw := make(chan smemRollupRaw, 1)
+		go func() {
+			contents, err := readSmapsRollup(pid)
+			raw <- smemRollupRaw{pid, contents, err}
+		}()
+
+		parsed := make(chan SmemRollup, 1)
+		channels[pid] = parsed
+		go func() {
+			contents := <-raw
+			if contents.err != nil || len(contents.contents) == 0 {
+				parsed <- SmemRollup{pid, SmemHeader{0, 0}, nil}
+				return
+			}
+			parsed <- parseSmapsRollup(contents.pid, contents.contents)
+		}()
+	}
+	return channels
+}
+
+func reduceSmemRollupParsersSelect(channels map[int]chan SmemRollup) []SmemRollup {
+	cases := make([]reflect.SelectCase, 0, len(channels))
+	for _, ch := range channels {
+		cases = append(cases, reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ch)})
+	}
+	var rollups []SmemRollup
+	for remaining := len(cases); remaining > 0; remaining-- {
+		chosen, recv, _ := reflect.Select(cases)
+		cases[chosen].Chan = reflect.ValueOf(nil)
+		if rollup := recv.Interface().(SmemRollup); len(rollup.stats) > 0 {
+			rollups = append(rollups, rollup)
+		}
+	}
+	return rollups
+}
+
+func dispatchPidOwners(pids []int) map[int]chan pidOwnerResult {
+	channels := map[int]chan pidOwnerResult{}
+	for _, pid := range pids {
+		ch := make(chan pidOwnerResult, 1)
+		channels[pid] = ch
+		go func() {
+			owner, err := readPidOwner(pid)
+			ch <- pidOwnerResult{owner, err}
+		}()
+	}
+	return channels
+}
+
+func reducePidOwners(channels map[int]chan pidOwnerResult) map[int]PidOwner {
+	owners := map[int]PidOwner{}
+	for pid, ch := range channels {
+		if result := <-ch; result.err == nil {
+			owners[pid] = result.owner
+		}
+	}
+	return owners
+}
+
+func dispatchArgvReaders(pids []int) map[int]chan argvResult {
+	channels := map[int]chan argvResult{}
+	for _, pid := range pids {
+		ch := make(chan argvResult, 1)
+		channels[pid] = ch
+		go func() {
+			argv, err := readArgv(pid)
+			ch <- argvResult{pid, argv, err}
+		}()
+	}
+	return channels
+}
+
+func reduceArgvReaders(channels map[int]chan argvResult) map[int]string {
+	cmdlines := map[int]string{}
+	for pid, ch := range channels {
+		if result := <-ch; result.err == nil {
+			cmdlines[pid] = strings.Join(result.argv, " ")
+		}
+	}
+	return cmdlines
+}
+
+// collects what the old dispatcher did, into the same Process records
+func collectProcessesDispatch(pids []int) []Process {
+	rollupChannels := dispatchSmemRollupParsers(pids)
+	ownerChannels := dispatchPidOwners(pids)
+	argvChannels := dispatchArgvReaders(pids)
+
+	rollups := reduceSmemRollupParsersSelect(rollupChannels)
+	owners := reducePidOwners(ownerChannels)
+	cmdlines := reduceArgvReaders(argvChannels)
+
+	processes := make([]Process, 0, len(rollups))
+	for _, rollup := range rollups {
+		processes = append(processes, Process{
+			pid:     rollup.PID(),
+			rollup:  rollup,
+			owner:   owners[rollup.PID()],
+			cmdline: cmdlines[rollup.PID()],
+		})
+	}
+	return processes
+}
+
+func TestCollectProcessTimeout(t *testing.T) {
+	// a process that times out before its stat is read is shown incomplete
+	// rather than dropped
+	ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+	process := collectProcess(ctx, os.Getpid(), CollectOptions{})
+	if !process.incomplete || process.err != nil || process.PID() != os.Getpid() {
+		t.Errorf("collectProcess after its deadline = %+v, want PID %d incomplete", process, os.Getpid())
+	}
+
+	process = collectProcess(context.Background(), os.Getpid(), CollectOptions{})
+	if process.incomplete || process.err != nil || process.PSS() == 0 {
+		t.Errorf("collectProcess = %+v, want our own memory", process)
+	}
+}
+
+func TestCollectProcessesCancelled(t *testing.T) {
+	// PIDs not started before an interrupt are left out
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if processes := collectProcesses(ctx, []int{os.Getpid(), os.Getppid()}, CollectOptions{jobs: 2}); len(processes) != 0 {
+		t.Errorf("collectProcesses after cancel = %d processes, want none", len(processes))
+	}
+}
+
+func BenchmarkCollectProcesses(b *testing.B) {
+	pids := allProcesses()
+	jobCounts := []int{1, 2, 4, runtime.NumCPU(), 4 * runtime.NumCPU()}
+	slices.Sort(jobCounts)
+	for _, jobs := range slices.Compact(jobCounts) {
+		b.Run(fmt.Sprintf("jobs=%d", jobs), func(b *testing.B) {
+			options := CollectOptions{jobs: jobs}
+			for b.Loop() {
+				collectProcesses(context.Background(), pids, options)
+			}
+		})
+	}
+	b.Run("dispatch", func(b *testing.B) {
+		for b.Loop() {
+			collectProcessesDispatch(pids)
+		}
+	})
+}
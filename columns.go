@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// an optional output column, selected with --columns and usable as sort key
+type Column struct {
+	name   string // lower case name, for --columns and --key
+	header string
+	memory bool // value is a size in KiB, rather than a count
+	idle   bool // only available with --idle
+	numa   bool // needs /proc/PID/numa_maps
+	oom    bool // needs OOM scores and cgroup
+	value  func(Process) int
+	text   func(Process) string // for columns that are not numeric, instead of value
+	// reports whether the process has a value in this column, e.g. a cgroup limit
+	available func(Process) bool
+}
+
+// memory counters from /proc/PID/status, see proc_pid_status(5)
+var statusCounters = []string{
+	"VmPeak",
+	"VmSize",
+	"VmHWM",
+	"VmRSS",
+	"RssAnon",
+	"RssFile",
+	"RssShmem",
+	"VmSwap",
+	"VmPTE",
+	"VmLck",
+	"HugetlbPages",
+}
+
+func statusColumn(field string) Column {
+	name := strings.ToLower(field)
+	return Column{name: name, header: field, memory: true, value: func(p Process) int {
+		return p.status.counters[name]
+	}}
+}
+
+// a counter from smaps_rollup, see proc_pid_smaps(5)
+func rollupColumn(field string) Column {
+	name := strings.ToLower(field)
+	return Column{name: name, header: field, memory: true, value: func(p Process) int {
+		return p.rollup.stats[name]
+	}}
+}
+
+// working set and cold memory, sampled with --idle
+var idleColumns = []Column{
+	{name: "ws-rss", header: "WS RSS", memory: true, idle: true, value: func(p Process) int { return p.idle.wsRSS }},
+	{name: "cold-rss", header: "Cold RSS", memory: true, idle: true, value: func(p Process) int { return p.idle.coldRSS }},
+	{name: "ws-uss", header: "WS USS", memory: true, idle: true, value: func(p Process) int { return p.idle.wsUSS }},
+	{name: "cold-uss", header: "Cold USS", memory: true, idle: true, value: func(p Process) int { return p.idle.coldUSS }},
+}
+
+var optionalColumns = func() []Column {
+	var columns []Column
+	for _, field := range statusCounters {
+		columns = append(columns, statusColumn(field))
+	}
+	columns = appendColumns(columns, thpColumns)
+	columns = append(columns, idleColumns...)
+	columns = append(columns, numaPolicyColumn, numaRemoteColumn)
+	columns = append(columns, oomColumns...)
+	columns = append(columns, cgroupColumn)
+	return columns
+}()
+
+func findColumnIn(columns []Column, name string) (Column, bool) {
+	for _, column := range columns {
+		if column.name == strings.ToLower(name) {
+			return column, true
+		}
+	}
+	return Column{}, false
+}
+
+// finds an optional column by name, including per-node NUMA columns
+// (n0, n1, ...), which depend on the nodes of the system
+func findColumn(name string) (Column, bool) {
+	if column, ok := findColumnIn(optionalColumns, name); ok {
+		return column, true
+	}
+	if node, ok := parseNodeColumnName(name); ok {
+		return numaNodeColumn(node), true
+	}
+	return Column{}, false
+}
+
+// parses a comma separated list of column names
+func parseColumns(list string) ([]Column, error) {
+	var columns []Column
+	if list == "" {
+		return columns, nil
+	}
+	for _, name := range strings.Split(list, ",") {
+		column, ok := findColumn(strings.TrimSpace(name))
+		if !ok {
+			return nil, fmt.Errorf("unknown column: %s", name)
+		}
+		columns = append(columns, column)
+	}
+	return columns, nil
+}
+
+// appends those of extra columns that are not selected yet
+func appendColumns(columns []Column, extra []Column) []Column {
+	for _, column := range extra {
+		if _, ok := findColumnIn(columns, column.name); !ok {
+			columns = append(columns, column)
+		}
+	}
+	return columns
+}
+
+// which columns need data that is only collected on request
+func columnsNeed(columns []Column, need func(Column) bool) bool {
+	return slices.ContainsFunc(columns, need)
+}
+
+// renders the value of column for process
+func columnToString(process Process, column Column, humanReadable bool) string {
+	if process.incomplete {
+		return "?"
+	}
+	if column.available != nil && !column.available(process) {
+		return "-"
+	}
+	if column.text != nil {
+		return column.text(process)
+	}
+	value := column.value(process)
+	if column.memory {
+		return kiloBytesToString(value, humanReadable)
+	}
+	return fmt.Sprintf("%d", value)
+}
+
+// raw value of column for process, for machine readable output
+func columnValue(process Process, column Column) any {
+	if process.incomplete || (column.available != nil && !column.available(process)) {
+		return nil
+	}
+	if column.text != nil {
+		return column.text(process)
+	}
+	return column.value(process)
+}
@@ -0,0 +1,418 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// a parsed --where expression, e.g.
+// pss > 200M && (user == "postgres" || comm =~ "^pg_")
+type Expression struct {
+	op          string // a logical or comparison operator, "field" or "literal"
+	left, right *Expression
+	value       any            // name of a field, or a number, string or bool
+	pattern     *regexp.Regexp // right side of =~ and !~
+}
+
+type tokenKind int
+
+const (
+	tokenEnd tokenKind = iota
+	tokenOperator
+	tokenIdentifier
+	tokenNumber
+	tokenString
+)
+
+type token struct {
+	kind   tokenKind
+	text   string
+	value  any
+	offset int
+}
+
+// operators, longest first so that the lexer matches them greedily
+var expressionOperators = []string{"&&", "||", "==", "!=", "<=", ">=", "=~", "!~", "<", ">", "!", "(", ")"}
+
+var comparisonOperators = []string{"==", "!=", "<=", ">=", "=~", "!~", "<", ">"}
+
+// binary size suffixes of size literals, in KiB like the fields they are
+// compared with
+var sizeUnits = map[string]float64{
+	"b": 1.0 / 1024,
+	"k": 1,
+	"m": 1024,
+	"g": 1024 * 1024,
+	"t": 1024 * 1024 * 1024,
+}
+
+// parses a number, optionally followed by a size unit (K, M, G, T, with or
+// without iB or B), in which case it is converted to KiB
+func parseNumber(s string) (float64, error) {
+	digits := strings.TrimRightFunc(s, unicode.IsLetter)
+	n, err := strconv.ParseFloat(digits, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid number %s", s)
+	}
+	suffix := strings.ToLower(s[len(digits):])
+	if suffix == "" {
+		return n, nil
+	}
+	unit := strings.TrimSuffix(strings.TrimSuffix(suffix, "b"), "i")
+	if unit == "" {
+		unit = "b"
+	}
+	factor, ok := sizeUnits[unit]
+	if !ok || suffix != unit && suffix != unit+"b" && suffix != unit+"ib" {
+		return 0, fmt.Errorf("invalid size %s", s)
+	}
+	return n * factor, nil
+}
+
+func isIdentifierStart(r rune) bool {
+	return unicode.IsLetter(r) || r == '_'
+}
+
+// identifiers may contain dashes, like the names of columns
+func isIdentifierPart(r rune) bool {
+	return isIdentifierStart(r) || unicode.IsDigit(r) || r == '-'
+}
+
+func tokenize(s string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(s); {
+		r := rune(s[i])
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '"':
+			end := i + 1
+			for end < len(s) && s[end] != '"' {
+				if s[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(s) {
+				return nil, fmt.Errorf("unterminated string at offset %d", i)
+			}
+			value, err := strconv.Unquote(s[i : end+1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid string at offset %d: %v", i, err)
+			}
+			tokens = append(tokens, token{tokenString, s[i : end+1], value, i})
+			i = end + 1
+		case unicode.IsDigit(r) || r == '.':
+			end := i
+			for end < len(s) && (unicode.IsDigit(rune(s[end])) || s[end] == '.' || unicode.IsLetter(rune(s[end]))) {
+				end++
+			}
+			value, err := parseNumber(s[i:end])
+			if err != nil {
+				return nil, fmt.Errorf("%v at offset %d", err, i)
+			}
+			tokens = append(tokens, token{tokenNumber, s[i:end], value, i})
+			i = end
+		case isIdentifierStart(r):
+			end := i
+			for end < len(s) && isIdentifierPart(rune(s[end])) {
+				end++
+			}
+			tokens = append(tokens, token{tokenIdentifier, s[i:end], s[i:end], i})
+			i = end
+		default:
+			j := slices.IndexFunc(expressionOperators, func(op string) bool {
+				return strings.HasPrefix(s[i:], op)
+			})
+			if j < 0 {
+				return nil, fmt.Errorf("unexpected %q at offset %d", s[i], i)
+			}
+			op := expressionOperators[j]
+			tokens = append(tokens, token{tokenOperator, op, nil, i})
+			i += len(op)
+		}
+	}
+	return append(tokens, token{tokenEnd, "end of expression", nil, len(s)}), nil
+}
+
+// recursive descent parser of
+//
+//	or         = and { "||" and }
+//	and        = unary { "&&" unary }
+//	unary      = "!" unary | comparison
+//	comparison = primary [ comparison-operator primary ]
+//	primary    = "(" or ")" | operand
+type expressionParser struct {
+	tokens   []token
+	position int
+	fields   []string // names of the fields identifiers resolve to
+}
+
+func (p *expressionParser) peek() token {
+	return p.tokens[p.position]
+}
+
+func (p *expressionParser) next() token {
+	t := p.tokens[p.position]
+	if t.kind != tokenEnd {
+		p.position++
+	}
+	return t
+}
+
+func (p *expressionParser) accept(op string) bool {
+	if t := p.peek(); t.kind == tokenOperator && t.text == op {
+		p.position++
+		return true
+	}
+	return false
+}
+
+func unexpected(t token) error {
+	return fmt.Errorf("unexpected %s at offset %d", t.text, t.offset)
+}
+
+func (p *expressionParser) or() (*Expression, error) {
+	left, err := p.and()
+	for err == nil && p.accept("||") {
+		var right *Expression
+		right, err = p.and()
+		left = &Expression{op: "||", left: left, right: right}
+	}
+	return left, err
+}
+
+func (p *expressionParser) and() (*Expression, error) {
+	left, err := p.unary()
+	for err == nil && p.accept("&&") {
+		var right *Expression
+		right, err = p.unary()
+		left = &Expression{op: "&&", left: left, right: right}
+	}
+	return left, err
+}
+
+func (p *expressionParser) unary() (*Expression, error) {
+	if p.accept("!") {
+		operand, err := p.unary()
+		return &Expression{op: "!", left: operand}, err
+	}
+	return p.comparison()
+}
+
+func (p *expressionParser) comparison() (*Expression, error) {
+	left, err := p.primary()
+	if err != nil {
+		return nil, err
+	}
+	t := p.peek()
+	if t.kind != tokenOperator || !slices.Contains(comparisonOperators, t.text) {
+		return left, nil
+	}
+	p.next()
+	right, err := p.primary()
+	if err != nil {
+		return nil, err
+	}
+	e := &Expression{op: t.text, left: left, right: right}
+	if t.text == "=~" || t.text == "!~" {
+		pattern, ok := right.value.(string)
+		if right.op != "literal" || !ok {
+			return nil, fmt.Errorf("%s at offset %d needs a string pattern", t.text, t.offset)
+		}
+		if e.pattern, err = regexp.Compile(pattern); err != nil {
+			return nil, err
+		}
+	}
+	return e, nil
+}
+
+func (p *expressionParser) primary() (*Expression, error) {
+	if p.accept("(") {
+		e, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if !p.accept(")") {
+			return nil, unexpected(p.peek())
+		}
+		return e, nil
+	}
+	return p.operand()
+}
+
+func (p *expressionParser) operand() (*Expression, error) {
+	t := p.next()
+	switch t.kind {
+	case tokenNumber, tokenString:
+		return &Expression{op: "literal", value: t.value}, nil
+	case tokenIdentifier:
+		switch t.text {
+		case "true":
+			return &Expression{op: "literal", value: true}, nil
+		case "false":
+			return &Expression{op: "literal", value: false}, nil
+		}
+		if !slices.Contains(p.fields, t.text) {
+			return nil, fmt.Errorf("unknown field %s at offset %d", t.text, t.offset)
+		}
+		return &Expression{op: "field", value: t.text}, nil
+	}
+	return nil, unexpected(t)
+}
+
+// parses an expression over the fields available to templates
+func parseExpression(s string, fields []Field) (*Expression, error) {
+	tokens, err := tokenize(s)
+	if err != nil {
+		return nil, err
+	}
+	p := expressionParser{tokens: tokens, fields: templateFieldNames(fields)}
+	e, err := p.or()
+	if err == nil && p.peek().kind != tokenEnd {
+		err = unexpected(p.peek())
+	}
+	return e, err
+}
+
+// numbers of any type, as float64
+func toNumber(v any) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+	return 0, false
+}
+
+// nil, false, zero and empty values are false
+func truthy(v any) bool {
+	if n, ok := toNumber(v); ok {
+		return n != 0
+	}
+	switch v := v.(type) {
+	case bool:
+		return v
+	case string:
+		return v != ""
+	case []string:
+		return len(v) > 0
+	}
+	return v != nil
+}
+
+// compares numbers, strings or bools; fields of incomplete processes are
+// nil, which only differs (!=) from every value
+func compare(op string, left, right any) (bool, error) {
+	if left == nil || right == nil {
+		return op == "!=", nil
+	}
+	var c int
+	if a, ok := toNumber(left); ok {
+		b, ok := toNumber(right)
+		if !ok {
+			return false, fmt.Errorf("cannot compare number %v with %v", left, right)
+		}
+		c = cmp.Compare(a, b)
+	} else if a, ok := left.(string); ok {
+		b, ok := right.(string)
+		if !ok {
+			return false, fmt.Errorf("cannot compare string %q with %v", a, right)
+		}
+		c = strings.Compare(a, b)
+	} else if a, ok := left.(bool); ok {
+		b, ok := right.(bool)
+		if !ok || op != "==" && op != "!=" {
+			return false, fmt.Errorf("cannot compare %v %s %v", left, op, right)
+		}
+		if a != b {
+			c = 1
+		}
+	} else {
+		return false, fmt.Errorf("cannot compare %v %s %v", left, op, right)
+	}
+	switch op {
+	case "==":
+		return c == 0, nil
+	case "!=":
+		return c != 0, nil
+	case "<":
+		return c < 0, nil
+	case "<=":
+		return c <= 0, nil
+	case ">":
+		return c > 0, nil
+	}
+	return c >= 0, nil
+}
+
+// evaluates the expression with the fields of a process
+func (e *Expression) eval(data map[string]any) (any, error) {
+	switch e.op {
+	case "literal":
+		return e.value, nil
+	case "field":
+		// resolved while parsing, but counters of smaps_rollup may be
+		// missing if no process has them
+		return data[e.value.(string)], nil
+	case "!":
+		operand, err := e.left.eval(data)
+		return !truthy(operand), err
+	}
+
+	left, err := e.left.eval(data)
+	if err != nil {
+		return nil, err
+	}
+	switch e.op {
+	case "&&", "||":
+		// short circuit
+		if truthy(left) == (e.op == "||") {
+			return truthy(left), nil
+		}
+		right, err := e.right.eval(data)
+		return truthy(right), err
+	case "=~", "!~":
+		if left == nil {
+			return false, nil
+		}
+		var s string
+		if argv, ok := left.([]string); ok {
+			s = strings.Join(argv, " ")
+		} else {
+			s = fmt.Sprint(left)
+		}
+		return e.pattern.MatchString(s) == (e.op == "=~"), nil
+	}
+	right, err := e.right.eval(data)
+	if err != nil {
+		return nil, err
+	}
+	return compare(e.op, left, right)
+}
+
+// keeps the processes for which the expression is true, with the fields
+// available to --format templates
+func filterProcesses(processes []Process, where *Expression, fields []Field) ([]Process, error) {
+	rollupStats := rollupStatNames(processes)
+	var err error
+	processes = slices.DeleteFunc(processes, func(p Process) bool {
+		if err != nil {
+			return false
+		}
+		var match any
+		match, err = where.eval(templateData(p, fields, rollupStats))
+		return !truthy(match)
+	})
+	return processes, err
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseNumber(t *testing.T) {
+	tests := []struct {
+		s    string
+		want float64
+		err  string
+	}{
+		{"100", 100, ""},
+		{"1.5", 1.5, ""},
+		{"1.5G", 1.5 * 1024 * 1024, ""},
+		{"512KiB", 512, ""},
+		{"512k", 512, ""},
+		{"4MB", 4 * 1024, ""},
+		{"2T", 2 * 1024 * 1024 * 1024, ""},
+		{"10B", 10.0 / 1024, ""},
+		{"10X", 0, "invalid size 10X"},
+		{"10GiBs", 0, "invalid size 10GiBs"},
+		{"1.2.3", 0, "invalid number 1.2.3"},
+	}
+	for _, test := range tests {
+		got, err := parseNumber(test.s)
+		if test.err != "" {
+			if err == nil || err.Error() != test.err {
+				t.Errorf("parseNumber(%q) error = %v, want %s", test.s, err, test.err)
+			}
+			continue
+		}
+		if err != nil || got != test.want {
+			t.Errorf("parseNumber(%q) = %v, %v, want %v", test.s, got, err, test.want)
+		}
+	}
+}
+
+func evalExpression(t *testing.T, s string, data map[string]any) (bool, error) {
+	t.Helper()
+	e, err := parseExpression(s, outputFields(RenderOptions{}))
+	if err != nil {
+		t.Fatalf("parseExpression(%q): %v", s, err)
+	}
+	match, err := e.eval(data)
+	return truthy(match), err
+}
+
+func TestExpressionEval(t *testing.T) {
+	process := map[string]any{
+		"pid":        1234,
+		"user":       "postgres",
+		"comm":       "pg_ctl",
+		"argv":       []string{"/usr/bin/python3", "manage.py", "runserver"},
+		"pss":        300 * 1024,
+		"rss":        400 * 1024,
+		"incomplete": false,
+	}
+	incomplete := map[string]any{
+		"pid":        1234,
+		"comm":       "pg_ctl",
+		"pss":        nil,
+		"incomplete": true,
+	}
+	tests := []struct {
+		s    string
+		data map[string]any
+		want bool
+	}{
+		// ! binds tighter than &&, which binds tighter than ||
+		{"!false && false", process, false},
+		{"!(false && false)", process, true},
+		{"true || false && false", process, true},
+		{"(true || false) && false", process, false},
+		{"false && false || true", process, true},
+		{"!true || true", process, true},
+
+		// sizes and parenthesised operands
+		{"pss > 200M", process, true},
+		{"pss > 300M", process, false},
+		{"pss >= 300MiB && rss <= 400M", process, true},
+		{"(pss) > 5", process, true},
+		{"(pss > 200M) == true", process, true},
+		{"pss > 200M && (user == \"nobody\" || comm =~ \"^pg_\")", process, true},
+
+		// regular expressions on argv match the joined command line
+		{"argv =~ \"manage\\\\.py runserver$\"", process, true},
+		{"argv =~ \"^manage\"", process, false},
+		{"argv !~ \"java\"", process, true},
+		{"comm =~ \"^pg_\"", incomplete, true},
+
+		// fields of incomplete processes only differ from every value
+		{"pss > 0", incomplete, false},
+		{"pss < 0", incomplete, false},
+		{"pss == 0", incomplete, false},
+		{"pss != 0", incomplete, true},
+		{"pss =~ \".\"", incomplete, false},
+		{"!pss", incomplete, true},
+		{"incomplete", incomplete, true},
+	}
+	for _, test := range tests {
+		got, err := evalExpression(t, test.s, test.data)
+		if err != nil || got != test.want {
+			t.Errorf("%s = %v, %v, want %v", test.s, got, err, test.want)
+		}
+	}
+}
+
+func TestExpressionTypeMismatch(t *testing.T) {
+	process := map[string]any{"pss": 1024, "comm": "bash", "incomplete": false}
+	tests := []struct {
+		s   string
+		err string
+	}{
+		{"pss == \"big\"", "cannot compare number 1024 with big"},
+		{"comm > 5", "cannot compare string \"bash\" with 5"},
+		{"incomplete < true", "cannot compare false < true"},
+		{"incomplete == 1", "cannot compare false == 1"},
+		{"true && pss == comm", "cannot compare number 1024 with bash"},
+	}
+	for _, test := range tests {
+		_, err := evalExpression(t, test.s, process)
+		if err == nil || err.Error() != test.err {
+			t.Errorf("%s error = %v, want %s", test.s, err, test.err)
+		}
+	}
+}
+
+func TestParseExpressionErrors(t *testing.T) {
+	tests := []struct {
+		s   string
+		err string
+	}{
+		{"pss > 5 &&", "unexpected end of expression at offset 10"},
+		{"nosuchfield > 1", "unknown field nosuchfield at offset 0"},
+		{"pss > 10X", "invalid size 10X at offset 6"},
+		{"comm == \"pg", "unterminated string at offset 8"},
+		{"(pss > 1", "unexpected end of expression at offset 8"},
+		{"pss > 1)", "unexpected ) at offset 7"},
+		{"pss @ 1", "unexpected '@' at offset 4"},
+		{"comm =~ pss", "=~ at offset 5 needs a string pattern"},
+		{"pss > > 1", "unexpected > at offset 6"},
+	}
+	for _, test := range tests {
+		_, err := parseExpression(test.s, outputFields(RenderOptions{}))
+		if err == nil || !strings.HasPrefix(err.Error(), test.err) {
+			t.Errorf("parseExpression(%q) error = %v, want %s", test.s, err, test.err)
+		}
+	}
+}
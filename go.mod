@@ -4,6 +4,7 @@ go 1.24.0
 
 require (
 	github.com/dustin/go-humanize v1.0.1
+	github.com/google/pprof v0.0.0-20260115054156-294ebfa9ad83
 	github.com/jedib0t/go-pretty/v6 v6.6.9
 	golang.org/x/sys v0.37.0
 	golang.org/x/term v0.36.0
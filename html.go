@@ -0,0 +1,347 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jedib0t/go-pretty/v6/text"
+)
+
+// a self-contained HTML page, without external assets,
+// so that it can be attached to tickets and opened offline
+type HTMLPage struct {
+	Title    string
+	Subtitle string
+	Charts   []Chart
+	Treemap  []TreemapRect
+	Headers  []HTMLCell
+	Rows     [][]HTMLCell
+}
+
+// a table cell, or a header
+type HTMLCell struct {
+	Text    string
+	Sort    string // value to sort on, if it differs from the text
+	Numeric bool
+}
+
+const treemapWidth = 1200
+const treemapHeight = 600
+
+var htmlTemplate = template.Must(template.New("page").Funcs(template.FuncMap{
+	"add": func(a, b float64) float64 { return a + b },
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: sans-serif; margin: 1em 2em; color: #222; }
+h2 { font-size: 1.1em; margin-top: 1.5em; }
+table { border-collapse: collapse; font-size: 13px; }
+th, td { padding: 2px 8px; white-space: nowrap; text-align: left; }
+th { cursor: pointer; background: #e8e8e8; position: sticky; top: 0; user-select: none; }
+th[data-order=asc]::after { content: " \25B2"; }
+th[data-order=desc]::after { content: " \25BC"; }
+.number { text-align: right; font-variant-numeric: tabular-nums; }
+td:last-child { white-space: normal; word-break: break-all; min-width: 30em; }
+tbody tr:nth-child(even) { background: #f6f6f6; }
+svg { display: block; max-width: 100%; height: auto; }
+svg text { font-size: 11px; fill: #222; }
+.treemap rect { stroke: #fff; }
+.treemap text { pointer-events: none; }
+.chart .axis { stroke: #999; }
+.chart .grid { stroke: #e4e4e4; }
+.chart polyline { fill: none; stroke-width: 1.5; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<p>{{.Subtitle}}</p>
+{{range .Charts}}
+<h2>{{.Title}}</h2>
+<svg class="chart" viewBox="0 0 {{.Width}} {{.Height}}" width="{{.Width}}" height="{{.Height}}">
+{{- $chart := .}}
+{{- range .YTicks}}
+<line class="grid" x1="{{$chart.Left}}" x2="{{$chart.Right}}" y1="{{printf "%.1f" .Pos}}" y2="{{printf "%.1f" .Pos}}"/>
+<text x="{{add $chart.Left -4}}" y="{{printf "%.1f" (add .Pos 4)}}" text-anchor="end">{{.Text}}</text>
+{{- end}}
+{{- range .XTicks}}
+<text x="{{printf "%.1f" .Pos}}" y="{{add $chart.Bottom 15}}" text-anchor="middle">{{.Text}}</text>
+{{- end}}
+<line class="axis" x1="{{.Left}}" x2="{{.Right}}" y1="{{.Bottom}}" y2="{{.Bottom}}"/>
+<line class="axis" x1="{{.Left}}" x2="{{.Left}}" y1="{{.Top}}" y2="{{.Bottom}}"/>
+{{- range $i, $line := .Lines}}
+<polyline points="{{.Points}}" stroke="{{.Color}}"><title>{{.Name}}</title></polyline>
+<rect x="{{add $chart.Right 12}}" y="{{printf "%.1f" .LegendY}}" width="10" height="10" fill="{{.Color}}"/>
+<text x="{{add $chart.Right 26}}" y="{{printf "%.1f" (add .LegendY 9)}}">{{.Name}}</text>
+{{- end}}
+</svg>
+{{end}}
+{{- if .Treemap}}
+<h2>Memory by user, unit and process (PSS)</h2>
+<svg class="treemap" viewBox="0 0 ` + strconv.Itoa(treemapWidth) + ` ` + strconv.Itoa(treemapHeight) + `" width="` + strconv.Itoa(treemapWidth) + `" height="` + strconv.Itoa(treemapHeight) + `">
+{{- range .Treemap}}
+<rect x="{{printf "%.1f" .X}}" y="{{printf "%.1f" .Y}}" width="{{printf "%.1f" .W}}" height="{{printf "%.1f" .H}}" fill="{{.Fill}}"><title>{{.Title}}</title></rect>
+{{- if .Label}}
+<text x="{{printf "%.1f" (add .X 3)}}" y="{{printf "%.1f" (add .Y 11)}}">{{.Label}}</text>
+{{- end}}
+{{- end}}
+</svg>
+{{- end}}
+<h2>Processes</h2>
+<table class="sortable">
+<thead><tr>{{range .Headers}}<th{{if .Numeric}} class="number" data-numeric="true"{{end}}>{{.Text}}</th>{{end}}</tr></thead>
+<tbody>
+{{- range .Rows}}
+<tr>{{range .}}<td{{if .Numeric}} class="number"{{end}}{{if .Sort}} data-sort="{{.Sort}}"{{end}}>{{.Text}}</td>{{end}}</tr>
+{{- end}}
+</tbody>
+</table>
+<script>
+document.querySelectorAll("table.sortable th").forEach((th, column) => th.addEventListener("click", () => {
+  const table = th.closest("table");
+  const ascending = th.dataset.order !== "asc";
+  table.querySelectorAll("th").forEach(other => delete other.dataset.order);
+  th.dataset.order = ascending ? "asc" : "desc";
+  const key = row => row.cells[column].dataset.sort ?? row.cells[column].textContent;
+  const compare = th.dataset.numeric
+    ? (a, b) => (parseFloat(key(a)) || 0) - (parseFloat(key(b)) || 0)
+    : (a, b) => key(a).localeCompare(key(b));
+  const body = table.tBodies[0];
+  Array.from(body.rows)
+    .sort((a, b) => ascending ? compare(a, b) : compare(b, a))
+    .forEach(row => body.appendChild(row));
+}));
+</script>
+</body>
+</html>
+`))
+
+func renderHTML(out io.Writer, page HTMLPage) {
+	if err := htmlTemplate.Execute(out, page); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+	}
+}
+
+// a line chart of memory over time
+type Chart struct {
+	Title                    string
+	Width, Height            float64
+	Left, Right, Top, Bottom float64 // of the plot area
+	Lines                    []ChartLine
+	XTicks, YTicks           []ChartTick
+}
+
+type ChartLine struct {
+	Name    string
+	Color   string
+	Points  string // x,y pairs of an SVG polyline
+	LegendY float64
+}
+
+type ChartTick struct {
+	Pos  float64
+	Text string
+}
+
+// values of a line, in KiB
+type ChartSeries struct {
+	name   string
+	times  []time.Time
+	values []int
+}
+
+const chartTicks = 5
+
+func makeChart(title string, series []ChartSeries, start, end time.Time, humanReadable bool) Chart {
+	chart := Chart{Title: title, Width: 1000, Height: 260, Left: 80, Right: 820, Top: 10, Bottom: 230}
+	highest := 1
+	for _, s := range series {
+		for _, value := range s.values {
+			highest = max(highest, value)
+		}
+	}
+	span := end.Sub(start)
+	x := func(t time.Time) float64 {
+		if span <= 0 {
+			return chart.Left
+		}
+		return chart.Left + (chart.Right-chart.Left)*float64(t.Sub(start))/float64(span)
+	}
+	y := func(value int) float64 {
+		return chart.Bottom - (chart.Bottom-chart.Top)*float64(value)/float64(highest)
+	}
+
+	for i := 0; i <= chartTicks; i++ {
+		value := highest * i / chartTicks
+		chart.YTicks = append(chart.YTicks, ChartTick{y(value), kiloBytesToString(value, humanReadable)})
+		sampled := start.Add(span * time.Duration(i) / chartTicks)
+		chart.XTicks = append(chart.XTicks, ChartTick{x(sampled), sampled.Local().Format(time.TimeOnly)})
+	}
+	for i, s := range series {
+		var points strings.Builder
+		for j, value := range s.values {
+			fmt.Fprintf(&points, "%.1f,%.1f ", x(s.times[j]), y(value))
+		}
+		chart.Lines = append(chart.Lines, ChartLine{
+			Name:    s.name,
+			Color:   fmt.Sprintf("hsl(%d, 65%%, 42%%)", i*137%360),
+			Points:  strings.TrimSpace(points.String()),
+			LegendY: chart.Top + float64(i)*16,
+		})
+	}
+	return chart
+}
+
+// name of a process in the treemap
+func treemapLabel(pid int, command string) string {
+	name := command
+	if fields := strings.Fields(command); len(fields) > 0 {
+		name = path.Base(fields[0])
+	}
+	return fmt.Sprintf("%s (%d)", name, pid)
+}
+
+// a page with the table of the processes, and a treemap of their PSS
+// by user, unit, process and class of mapping
+func snapshotPage(processes []Process, fields []Field, options RenderOptions) HTMLPage {
+	hostname, _ := os.Hostname()
+	page := HTMLPage{
+		Title:    "psmaps on " + hostname,
+		Subtitle: time.Now().Format(time.DateTime),
+	}
+
+	root := &TreeNode{}
+	for _, process := range processes {
+		if process.incomplete {
+			continue
+		}
+		name := process.stat.comm
+		if name == "" {
+			name = process.Command()
+		}
+		branch := []string{process.User(), cgroupUnit(process.oom.cgroup), fmt.Sprintf("%s (%d)", name, process.pid)}
+		if len(process.mappings) == 0 {
+			root.add(branch, process.PSS())
+			continue
+		}
+		for _, mapping := range process.mappings {
+			root.add(append(branch, mapping.class()), mapping.PSS())
+		}
+	}
+	page.Treemap = layoutTreemap(root, Rect{0, 0, treemapWidth, treemapHeight}, options.humanReadable)
+
+	for _, field := range fields {
+		page.Headers = append(page.Headers, HTMLCell{Text: field.header, Numeric: field.align == text.AlignRight})
+	}
+	for _, process := range processes {
+		var row []HTMLCell
+		for _, field := range fields {
+			cell := HTMLCell{Text: field.cell(process), Numeric: field.align == text.AlignRight}
+			if value := field.value(process); value != nil && cell.Numeric {
+				cell.Sort = fmt.Sprint(value)
+			}
+			row = append(row, cell)
+		}
+		page.Rows = append(page.Rows, row)
+	}
+	return page
+}
+
+// a page with charts of the total memory and of the largest rows over time,
+// the statistics of each row, and a treemap of the peak PSS of processes
+func reportPage(rows []ReportRow, group string, records []Record, humanReadable bool) HTMLPage {
+	start, end := records[0].Time, records[len(records)-1].Time
+	page := HTMLPage{
+		Title:    "psmaps report",
+		Subtitle: fmt.Sprintf("%d samples from %s to %s", countSamples(records), start.Local().Format(time.DateTime), end.Local().Format(time.DateTime)),
+	}
+
+	// records are sorted by time
+	totals := make([]ChartSeries, len(reportMetrics))
+	for i, metric := range reportMetrics {
+		totals[i].name = metric.name
+		for j, record := range records {
+			if j == 0 || !record.Time.Equal(records[j-1].Time) {
+				totals[i].times = append(totals[i].times, record.Time)
+				totals[i].values = append(totals[i].values, 0)
+			}
+			totals[i].values[len(totals[i].values)-1] += metric.value(record)
+		}
+	}
+	page.Charts = append(page.Charts, makeChart("Total memory", totals, start, end, humanReadable))
+
+	largest := slices.Clone(rows)
+	slices.SortStableFunc(largest, func(a, b ReportRow) int { return cmp.Compare(b.metrics[0].max, a.metrics[0].max) })
+	var series []ChartSeries
+	for _, row := range largest[:min(len(largest), 8)] {
+		s := ChartSeries{name: row.name, values: row.metrics[0].values}
+		if group == "" {
+			s.name = treemapLabel(row.process.PID(), row.process.Command())
+		}
+		for _, record := range row.records {
+			s.times = append(s.times, record.Time)
+		}
+		series = append(series, s)
+	}
+	title := "PSS of the largest processes"
+	if group != "" {
+		title = "PSS of the largest groups by " + group
+	}
+	page.Charts = append(page.Charts, makeChart(title, series, start, end, humanReadable))
+
+	root := &TreeNode{}
+	for _, row := range processRows(records, start, end) {
+		first := row.records[0]
+		root.add([]string{first.User, cgroupUnit(first.Cgroup), treemapLabel(first.PID, first.Command)}, row.metrics[0].max)
+	}
+	page.Treemap = layoutTreemap(root, Rect{0, 0, treemapWidth, treemapHeight}, humanReadable)
+
+	if group == "" {
+		page.Headers = []HTMLCell{{Text: "PID", Numeric: true}, {Text: "User"}}
+	} else {
+		page.Headers = []HTMLCell{{Text: strings.ToUpper(group[:1]) + group[1:]}, {Text: "Procs", Numeric: true}}
+	}
+	page.Headers = append(page.Headers, HTMLCell{Text: "Lifetime", Numeric: true})
+	for _, metric := range reportMetrics {
+		for _, stat := range []string{"Min", "P50", "P95", "Max"} {
+			page.Headers = append(page.Headers, HTMLCell{Text: metric.name + " " + stat, Numeric: true})
+		}
+	}
+	page.Headers = append(page.Headers, HTMLCell{Text: "PSS Peak At"})
+	if group == "" {
+		page.Headers = append(page.Headers, HTMLCell{Text: "Command"})
+	}
+
+	size := func(value int) HTMLCell {
+		return HTMLCell{Text: kiloBytesToString(value, humanReadable), Sort: strconv.Itoa(value), Numeric: true}
+	}
+	for _, row := range rows {
+		var cells []HTMLCell
+		if group == "" {
+			cells = []HTMLCell{{Text: strconv.Itoa(row.process.PID()), Numeric: true}, {Text: row.process.User()}}
+		} else {
+			cells = []HTMLCell{{Text: row.name}, {Text: strconv.Itoa(row.procs), Numeric: true}}
+		}
+		lifetime := row.last.Sub(row.first)
+		cells = append(cells, HTMLCell{Text: durationToString(lifetime), Sort: strconv.FormatInt(int64(lifetime), 10), Numeric: true})
+		for _, stats := range row.metrics {
+			cells = append(cells, size(stats.min), size(stats.p50), size(stats.p95), size(stats.max))
+		}
+		cells = append(cells, HTMLCell{Text: row.metrics[0].peak.Local().Format(time.DateTime)})
+		if group == "" {
+			cells = append(cells, HTMLCell{Text: row.process.Command()})
+		}
+		page.Rows = append(page.Rows, cells)
+	}
+	return page
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"os"
+	"slices"
+	"time"
+)
+
+// see Documentation/admin-guide/mm/idle_page_tracking.rst in the kernel sources
+const pageIdleBitmap = "/sys/kernel/mm/page_idle/bitmap"
+
+// working set and cold memory of a process, in KiB
+type IdleStats struct {
+	wsRSS   int // resident pages accessed during the interval
+	coldRSS int // resident pages not accessed
+	wsUSS   int // unique pages accessed
+	coldUSS int // unique pages not accessed
+}
+
+// the idle page bitmap: one bit per page frame, in 64 bit words
+type IdleBitmap struct {
+	file *os.File
+}
+
+func openIdleBitmap() (*IdleBitmap, error) {
+	file, err := os.OpenFile(pageIdleBitmap, os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+	return &IdleBitmap{file}, nil
+}
+
+func (b *IdleBitmap) Close() {
+	b.file.Close()
+}
+
+// bits to set in each word of the bitmap for the given page frames
+func idleWordMasks(pfns []uint64) (map[uint64]uint64, []uint64) {
+	masks := map[uint64]uint64{}
+	for _, pfn := range pfns {
+		masks[pfn/64] |= 1 << (pfn % 64)
+	}
+	words := make([]uint64, 0, len(masks))
+	for word := range masks {
+		words = append(words, word)
+	}
+	slices.Sort(words)
+	return masks, words
+}
+
+// calls f for each run of consecutive words
+func forEachWordRun(words []uint64, f func(first uint64, count int) error) error {
+	for i := 0; i < len(words); {
+		j := i + 1
+		for j < len(words) && words[j] == words[j-1]+1 {
+			j++
+		}
+		if err := f(words[i], j-i); err != nil {
+			return err
+		}
+		i = j
+	}
+	return nil
+}
+
+// marks the given page frames idle; the kernel clears the bit
+// of a page once it is accessed
+func (b *IdleBitmap) markIdle(pfns []uint64) error {
+	masks, words := idleWordMasks(pfns)
+	return forEachWordRun(words, func(first uint64, count int) error {
+		buf := make([]byte, count*8)
+		for i := range count {
+			binary.LittleEndian.PutUint64(buf[i*8:], masks[first+uint64(i)])
+		}
+		_, err := b.file.WriteAt(buf, int64(first*8))
+		return err
+	})
+}
+
+// reports which of the given page frames are still idle
+func (b *IdleBitmap) idle(pfns []uint64) (map[uint64]bool, error) {
+	_, words := idleWordMasks(pfns)
+	bits := map[uint64]uint64{}
+	err := forEachWordRun(words, func(first uint64, count int) error {
+		buf := make([]byte, count*8)
+		if _, err := b.file.ReadAt(buf, int64(first*8)); err != nil {
+			return err
+		}
+		for i := range count {
+			bits[first+uint64(i)] = binary.LittleEndian.Uint64(buf[i*8:])
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	idle := make(map[uint64]bool, len(pfns))
+	for _, pfn := range pfns {
+		idle[pfn] = bits[pfn/64]&(1<<(pfn%64)) != 0
+	}
+	return idle, nil
+}
+
+// marks all resident pages of processes idle, waits for interval,
+// and fills in how much of each process's memory was accessed meanwhile;
+// processes must have been collected with their page frames
+func sampleIdle(ctx context.Context, processes []Process, kpages *KPages, bitmap *IdleBitmap, interval time.Duration) error {
+	var pfns []uint64
+	for _, process := range processes {
+		for pfn := range process.frames {
+			pfns = append(pfns, pfn)
+		}
+	}
+	slices.Sort(pfns)
+	pfns = slices.Compact(pfns)
+
+	if err := bitmap.markIdle(pfns); err != nil {
+		return err
+	}
+
+	select {
+	case <-time.After(interval):
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	idle, err := bitmap.idle(pfns)
+	if err != nil {
+		return err
+	}
+	pages, err := kpages.lookup(pfns)
+	if err != nil {
+		return err
+	}
+
+	for i := range processes {
+		stats := IdleStats{}
+		for pfn, local := range processes[i].frames {
+			unique := pages[pfn].mapcount <= uint64(local)
+			size := local * pageSizeKiB
+			switch {
+			case idle[pfn]:
+				stats.coldRSS += size
+				if unique {
+					stats.coldUSS += size
+				}
+			default:
+				stats.wsRSS += size
+				if unique {
+					stats.wsUSS += size
+				}
+			}
+		}
+		processes[i].idle = stats
+	}
+	return nil
+}
@@ -0,0 +1,306 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"os/signal"
+	"runtime"
+	"slices"
+	"syscall"
+	"time"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/jedib0t/go-pretty/v6/text"
+)
+
+// identifies a process across samples, since PIDs are reused
+type ProcessKey struct {
+	pid       int
+	startTime uint64
+}
+
+func (p Process) Key() ProcessKey {
+	return ProcessKey{p.pid, p.stat.startTime}
+}
+
+// memory of a process at one point in time, in KiB
+type MemorySample struct {
+	time      time.Time
+	uss       int
+	pss       int
+	anonymous int
+}
+
+// memory samples of one process
+type MemorySeries struct {
+	process Process // as last seen
+	samples []MemorySample
+}
+
+// linear trend of a series of samples
+type Trend struct {
+	rate      float64 // KiB per hour, from a least squares fit
+	r2        float64 // coefficient of determination of the fit
+	monotonic float64 // share of steps between samples that did not shrink
+}
+
+// how sure we are that the process is steadily growing, 0 to 1:
+// growth that fits a line well and rarely goes down
+func (t Trend) confidence() float64 {
+	if t.rate <= 0 {
+		return 0
+	}
+	return t.r2 * t.monotonic
+}
+
+// fits a line to the value of each sample over time
+func fitTrend(samples []MemorySample, value func(MemorySample) int) Trend {
+	n := float64(len(samples))
+	if len(samples) < 2 {
+		return Trend{}
+	}
+
+	start := samples[0].time
+	var sumX, sumY, sumXX, sumXY float64
+	for _, sample := range samples {
+		x := sample.time.Sub(start).Hours()
+		y := float64(value(sample))
+		sumX += x
+		sumY += y
+		sumXX += x * x
+		sumXY += x * y
+	}
+	denominator := n*sumXX - sumX*sumX
+	if denominator == 0 {
+		return Trend{}
+	}
+	slope := (n*sumXY - sumX*sumY) / denominator
+	intercept := (sumY - slope*sumX) / n
+
+	// r2 = 1 - residual sum of squares / total sum of squares
+	meanY := sumY / n
+	var ssRes, ssTot float64
+	for _, sample := range samples {
+		x := sample.time.Sub(start).Hours()
+		y := float64(value(sample))
+		ssRes += math.Pow(y-(slope*x+intercept), 2)
+		ssTot += math.Pow(y-meanY, 2)
+	}
+	r2 := 0.0
+	if ssTot > 0 {
+		r2 = 1 - ssRes/ssTot
+	}
+
+	grew := 0
+	for i := 1; i < len(samples); i++ {
+		if value(samples[i]) >= value(samples[i-1]) {
+			grew++
+		}
+	}
+	return Trend{slope, r2, float64(grew) / float64(len(samples)-1)}
+}
+
+// a process found to be growing
+type Leak struct {
+	process    Process
+	samples    int
+	duration   time.Duration
+	uss        Trend
+	pss        Trend
+	anonymous  Trend
+	confidence float64 // best of the three trends
+}
+
+// fewest samples a trend is fitted to
+const leaksMinSamples = 3
+
+// fits trends to each series, and returns processes growing with at least
+// minConfidence, most confident first
+func findLeaks(series map[ProcessKey]*MemorySeries, minSamples int, minConfidence float64) []Leak {
+	var leaks []Leak
+	for _, s := range series {
+		if len(s.samples) < minSamples {
+			continue
+		}
+		leak := Leak{
+			process:   s.process,
+			samples:   len(s.samples),
+			duration:  s.samples[len(s.samples)-1].time.Sub(s.samples[0].time),
+			uss:       fitTrend(s.samples, func(m MemorySample) int { return m.uss }),
+			pss:       fitTrend(s.samples, func(m MemorySample) int { return m.pss }),
+			anonymous: fitTrend(s.samples, func(m MemorySample) int { return m.anonymous }),
+		}
+		leak.confidence = max(leak.uss.confidence(), leak.pss.confidence(), leak.anonymous.confidence())
+		if leak.confidence >= minConfidence {
+			leaks = append(leaks, leak)
+		}
+	}
+	slices.SortFunc(leaks, func(a, b Leak) int {
+		return cmp.Or(cmp.Compare(b.confidence, a.confidence), cmp.Compare(b.uss.rate, a.uss.rate))
+	})
+	return leaks
+}
+
+// renders a growth rate per hour
+func rateToString(rate float64, humanReadable bool) string {
+	sign := ""
+	if rate < 0 {
+		sign = "-"
+	}
+	return sign + kiloBytesToString(int(math.Abs(rate)), humanReadable) + "/h"
+}
+
+func renderLeaks(leaks []Leak, isWideOutput bool, humanReadable bool) {
+	t := table.NewWriter()
+
+	t.SetOutputMirror(os.Stdout)
+	t.SuppressTrailingSpaces()
+	t.SetColumnConfigs([]table.ColumnConfig{
+		{Number: 1, Align: text.AlignRight, AlignHeader: text.AlignRight},
+		{Number: 2, Align: text.AlignLeft, AlignHeader: text.AlignLeft},
+		{Number: 3, Align: text.AlignRight, AlignHeader: text.AlignRight},
+		{Number: 4, Align: text.AlignRight, AlignHeader: text.AlignRight},
+		{Number: 5, Align: text.AlignRight, AlignHeader: text.AlignRight},
+		{Number: 6, Align: text.AlignRight, AlignHeader: text.AlignRight},
+		{Number: 7, Align: text.AlignRight, AlignHeader: text.AlignRight},
+		{Number: 8, Align: text.AlignRight, AlignHeader: text.AlignRight},
+		{Number: 9, Align: text.AlignLeft, AlignHeader: text.AlignLeft},
+	})
+	t.Style().Options.DrawBorder = false
+	t.Style().Options.SeparateHeader = false
+	t.Style().Options.SeparateColumns = false
+	t.Style().Options.SeparateRows = false
+
+	t.AppendHeader(table.Row{"PID", "User", "Samples", "USS", "USS Growth", "PSS Growth", "Anon Growth", "Confidence", "Command"})
+	for _, leak := range leaks {
+		command := leak.process.Command()
+		if !isWideOutput {
+			command = truncateCommand(command, 40, false)
+		}
+		t.AppendRow(table.Row{
+			leak.process.PID(),
+			leak.process.User(),
+			leak.samples,
+			kiloBytesToString(leak.process.USS(), humanReadable),
+			rateToString(leak.uss.rate, humanReadable),
+			rateToString(leak.pss.rate, humanReadable),
+			rateToString(leak.anonymous.rate, humanReadable),
+			fmt.Sprintf("%.0f%%", leak.confidence*100),
+			command,
+		})
+	}
+
+	t.Render()
+}
+
+const flagDurationDescription = "how long to sample for"
+const flagMinConfidenceDescription = "report growth with at least this confidence (0-1)"
+
+func printLeaksUsage() {
+	fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s leaks [OPTION]... [PID]...\n", os.Args[0])
+	fmt.Fprintf(flag.CommandLine.Output(), `Sample memory of processes repeatedly, and report processes whose USS, PSS
+or anonymous memory grows steadily. Processes seen in fewer than a quarter
+of the samples, or fewer than 3, are not reported. Interrupt to report early.
+Options:
+  --help                %s
+  -w, --wide            %s
+  -h, --human-readable  %s
+  -j, --jobs            %s
+  -t, --timeout         %s
+  --interval            %s (default 10s)
+  --duration            %s (default 30m)
+  --min-confidence      %s (default 0.8)
+`,
+		flagHelpDescription,
+		flagWideDescription,
+		flagHumanReadableDescription,
+		flagJobsDescription,
+		flagTimeoutDescription,
+		flagIntervalDescription,
+		flagDurationDescription,
+		flagMinConfidenceDescription)
+}
+
+func runLeaks(args []string) int {
+	flags := flag.NewFlagSet("leaks", flag.ExitOnError)
+	var help, wideOutput, humanReadable bool
+	var jobs int
+	var timeout, interval, duration time.Duration
+	var minConfidence float64
+	flags.BoolVar(&help, "help", false, flagHelpDescription)
+	flags.BoolVar(&wideOutput, "wide", false, flagWideDescription)
+	flags.BoolVar(&wideOutput, "w", false, flagWideDescription)
+	flags.BoolVar(&humanReadable, "human-readable", false, flagHumanReadableDescription)
+	flags.BoolVar(&humanReadable, "h", false, flagHumanReadableDescription)
+	flags.IntVar(&jobs, "jobs", runtime.NumCPU(), flagJobsDescription)
+	flags.IntVar(&jobs, "j", runtime.NumCPU(), flagJobsDescription)
+	flags.DurationVar(&timeout, "timeout", 0, flagTimeoutDescription)
+	flags.DurationVar(&timeout, "t", 0, flagTimeoutDescription)
+	flags.DurationVar(&interval, "interval", 10*time.Second, flagIntervalDescription)
+	flags.DurationVar(&duration, "duration", 30*time.Minute, flagDurationDescription)
+	flags.Float64Var(&minConfidence, "min-confidence", 0.8, flagMinConfidenceDescription)
+	flags.Usage = printLeaksUsage
+	flags.Parse(args)
+
+	if help {
+		printLeaksUsage()
+		return ExitSuccess
+	}
+	if interval <= 0 || duration < interval {
+		fmt.Fprintf(os.Stderr, "error: interval must be positive and no longer than duration\n")
+		return ExitInvalidArguments
+	}
+
+	selectedPids, err := parsePidArgs(flags.Args())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return ExitInvalidArguments
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	ctx, cancel := context.WithTimeout(ctx, duration+interval/2)
+	defer cancel()
+
+	series := map[ProcessKey]*MemorySeries{}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	rounds := 0
+	for {
+		pids := selectedPids
+		if len(pids) == 0 {
+			pids = allProcesses()
+		}
+		now := time.Now()
+		for _, process := range collectProcesses(ctx, pids, CollectOptions{jobs: jobs, timeout: timeout}) {
+			if process.incomplete {
+				continue
+			}
+			s, ok := series[process.Key()]
+			if !ok {
+				s = &MemorySeries{}
+				series[process.Key()] = s
+			}
+			s.process = process
+			s.samples = append(s.samples, MemorySample{now, process.USS(), process.PSS(), process.rollup.stats["anonymous"]})
+		}
+		rounds++
+
+		select {
+		case <-ticker.C:
+			continue
+		case <-ctx.Done():
+		}
+		break
+	}
+
+	// a trend needs a few samples, and a quarter of the run to tell growth
+	// from noise, also when interrupted early
+	minSamples := max(leaksMinSamples, rounds/4)
+	renderLeaks(findLeaks(series, minSamples, minConfidence), wideOutput, humanReadable)
+	return ExitSuccess
+}
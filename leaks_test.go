@@ -0,0 +1,113 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+// a series of samples a minute apart, with the same USS, PSS and anonymous
+// memory
+func testSeries(pid int, values ...int) *MemorySeries {
+	start := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	s := &MemorySeries{process: Process{pid: pid, stat: ProcStat{pid: pid, startTime: uint64(pid)}}}
+	for i, value := range values {
+		s.samples = append(s.samples, MemorySample{start.Add(time.Duration(i) * time.Minute), value, value, value})
+	}
+	return s
+}
+
+func repeat(n int, value func(i int) int) []int {
+	values := make([]int, n)
+	for i := range values {
+		values[i] = value(i)
+	}
+	return values
+}
+
+var (
+	flat   = repeat(30, func(i int) int { return 1000 })
+	growth = repeat(30, func(i int) int { return 1000 + 100*i })
+	// grows and is freed again, like a cache or a garbage collected heap
+	sawtooth = repeat(30, func(i int) int { return 1000 + 100*(i%5) })
+	spike    = repeat(30, func(i int) int {
+		if i == 20 {
+			return 50000
+		}
+		return 1000
+	})
+)
+
+func TestFitTrend(t *testing.T) {
+	tests := []struct {
+		name       string
+		values     []int
+		fits       bool    // whether the line fits, and rate and r2 are checked
+		rate, r2   float64 // rate in KiB per hour
+		monotonic  float64
+		confidence float64 // at most
+	}{
+		{"flat", flat, true, 0, 0, 1, 0},
+		{"growth", growth, true, 6000, 1, 1, 1},
+		{"shrinking", repeat(30, func(i int) int { return 5000 - 100*i }), true, -6000, 1, 0, 0},
+		{"sawtooth", sawtooth, false, 0, 0, 24.0 / 29, 0.1},
+		// a positive slope, but a poor fit
+		{"spike", spike, false, 0, 0, 28.0 / 29, 0.1},
+	}
+	uss := func(m MemorySample) int { return m.uss }
+	for _, test := range tests {
+		trend := fitTrend(testSeries(1, test.values...).samples, uss)
+		if test.fits && (math.Abs(trend.rate-test.rate) > 1e-6 || math.Abs(trend.r2-test.r2) > 1e-6) {
+			t.Errorf("%s: rate = %v KiB/h with r2 %v, want %v with %v", test.name, trend.rate, trend.r2, test.rate, test.r2)
+		}
+		if math.Abs(trend.monotonic-test.monotonic) > 1e-9 {
+			t.Errorf("%s: monotonic = %v, want %v", test.name, trend.monotonic, test.monotonic)
+		}
+		if c := trend.confidence(); c > test.confidence {
+			t.Errorf("%s: confidence = %v, want at most %v", test.name, c, test.confidence)
+		}
+	}
+}
+
+func TestFitTrendTooFewSamples(t *testing.T) {
+	uss := func(m MemorySample) int { return m.uss }
+	for _, values := range [][]int{nil, {1000}} {
+		if trend := fitTrend(testSeries(1, values...).samples, uss); trend != (Trend{}) {
+			t.Errorf("fitTrend(%v) = %+v, want no trend", values, trend)
+		}
+	}
+}
+
+func TestFindLeaks(t *testing.T) {
+	series := map[ProcessKey]*MemorySeries{}
+	for pid, values := range map[int][]int{
+		1: flat,
+		2: growth,
+		3: sawtooth,
+		4: spike,
+		// growing, but seen too briefly
+		5: growth[:5],
+		// growing slower, but as steadily
+		6: repeat(30, func(i int) int { return 1000 + 10*i }),
+	} {
+		s := testSeries(pid, values...)
+		series[s.process.Key()] = s
+	}
+
+	leaks := findLeaks(series, 8, 0.8)
+	if len(leaks) != 2 {
+		t.Fatalf("found %d leaks, want 2: %+v", len(leaks), leaks)
+	}
+	// equally confident, the faster growing first
+	if leaks[0].process.PID() != 2 || leaks[1].process.PID() != 6 {
+		t.Errorf("leaks = PIDs %d and %d, want 2 and 6", leaks[0].process.PID(), leaks[1].process.PID())
+	}
+	if leak := leaks[0]; leak.samples != 30 || leak.duration != 29*time.Minute || leak.confidence < 0.999 {
+		t.Errorf("leak of PID 2 = %d samples over %v with confidence %v, want 30 over 29m0s with 1",
+			leak.samples, leak.duration, leak.confidence)
+	}
+
+	if leaks := findLeaks(series, 3, 0.8); len(leaks) != 3 {
+		t.Errorf("found %d leaks with 3 samples, want 3 with the short series", len(leaks))
+	}
+}
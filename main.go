@@ -17,6 +17,22 @@ Usage:
 
 psmaps [flags] [pid ...]
 
+psmaps summary [flags]
+
+psmaps shm [flags] [pid ...]
+
+psmaps shared [flags] pid ...
+
+psmaps leaks [flags] [pid ...]
+
+psmaps track [flags] pid
+
+psmaps record [flags] -o file [pid ...]
+
+psmaps report [flags] file ...
+
+psmaps watch [flags] [pid ...]
+
 Flags:
 
 	--help
@@ -26,23 +42,180 @@ Flags:
 		Always print the full command line, even if it exceeds the screen width.
 
 	-k, --key
-		Select field to sort output on.
+		Select field to sort output on: pid, threads, uss, pss, rss, swap,
+		user, command, or any of the columns.
 
 	-r, --reverse
 		Sort in reverse order.
 
 	-h, --human-readable
 		Print sizes in human readable format (e.g. MiB, GiB).
+
+	-j, --jobs
+		Number of worker goroutines collecting process data (default: number of CPUs).
+
+	-t, --timeout
+		Give up on a process whose data is not read within this duration (e.g. 500ms, 2s),
+		and show it as incomplete. Zero means no timeout.
+
+	-T, --threads
+		Show the number of threads of each process, and list its threads (tasks) under it.
+
+	-a, --all-tasks
+		Also show kernel threads and zombies, with their state and zero memory.
+
+	--kernel-threads
+		Show only kernel threads.
+
+	-x, --exact
+		Count unique and proportional pages exactly by walking /proc/PID/pagemap
+		and /proc/kpagecount (requires root). With several pids, also report
+		memory shared only among them.
+
+	-i, --idle
+		Estimate the working set using idle page tracking (requires root):
+		mark all pages of each process idle, wait for this duration (e.g. 30s),
+		and show how much of its RSS and USS was accessed meanwhile, and how much
+		stayed cold. Implies --exact.
+
+	--thp
+		Show transparent huge page and hugetlb usage of each process, the share
+		of its anonymous memory backed by THP, and a system line with THP settings
+		and huge page counters from /proc/meminfo.
+
+	--numa
+		Show resident memory of each process per NUMA node (N0, N1, ...), memory
+		on nodes other than that of the CPU it last ran on, and its memory policy,
+		from /proc/PID/numa_maps.
+
+	--oom
+		Show OOM killer scores (oom_score, oom_score_adj), and with cgroup v2,
+		memory.current of the cgroup of each process, the tightest memory.max of
+		the cgroup and its ancestors, and the headroom left under it. Sort with
+		-k oom -r to see the likely next OOM victims first.
+
+	-o, --output
+		Output format: table (default), csv, json, html, pprof, folded,
+		markdown, html-table or asciidoc. Machine readable formats have sizes
+		in KiB. markdown, html-table and asciidoc write the table for pasting
+		into documents, with full command lines escaped for the format. html writes a self-contained
+		page with a sortable table and a treemap of PSS by user, systemd unit,
+		process and class of mapping (heap, stack, anon, shm, file). pprof writes
+		a gzipped profile.proto for go tool pprof or speedscope, with a sample per
+		mapping of each process, stacks cgroup, unit, user, command name and
+		mapping, and PSS, USS, RSS and swap in bytes. folded writes the same
+		stacks with PSS in KiB in the folded format of flamegraph.pl.
+
+	-c, --columns
+		Comma separated list of additional columns to show, from /proc/PID/status:
+		vmpeak, vmsize, vmhwm, vmrss, rssanon, rssfile, rssshmem, vmswap, vmpte, vmlck, hugetlbpages;
+		from smaps_rollup: anonhugepages, shmempmdmapped, filepmdmapped, shared_hugetlb, private_hugetlb;
+		and thp-anon, the share of anonymous memory backed by THP in percent;
+		from /proc/PID/numa_maps: n0, n1, ... (per node), remote, policy;
+		oom, oom-adj, cgroup, cg-current, cg-max, headroom.
+		Any of these can also be used as a sort key.
+
+	-b, --batch
+		Print a sample every --interval until --count samples were printed or
+		interrupted, like top -b. Tables are preceded by the time of the sample,
+		machine readable formats have it in a time field.
+
+	--interval
+		Time between samples in batch mode (default: 5s).
+
+	--count
+		Stop batch mode after this many samples (default: 0, no limit).
+
+	--format
+		Print each process with a Go text/template instead of a table, e.g.
+		'{{.pid}} {{human .pss}} {{.command}}'. Fields are those of the other
+		formats, ppid, uid, comm, argv, and the counters of smaps_rollup and
+		status in lower case. Functions human, bytes, mib and gib convert
+		sizes, trunc, join and quote strings.
+
+	--format-file
+		Like --format, with the template read from a file.
+
+	--where
+		Show only processes for which an expression is true, evaluated after
+		collection and before sorting, e.g.
+		'pss > 200M && (user == "postgres" || comm =~ "^pg_")'. Fields are
+		those of --format; sizes are in KiB, or literals with a K, M, G or T
+		suffix. Operators are == != < <= > >=, =~ and !~ (regular expression
+		match), && || ! and parentheses.
+
+A thread ID given as a pid argument resolves to its process.
+
+Subcommands:
+
+	summary
+		Compare total PSS of all processes with /proc/meminfo, and show how much
+		memory in use is not attributable to any process (kernel, page cache,
+		tmpfs and SysV shared memory, hugetlb pool). Below, memory pressure
+		(PSI) of the system and of the cgroups with the largest total PSS.
+
+	shm
+		List shared memory objects (POSIX shm in /dev/shm, memfd, SysV shm,
+		shared anonymous mappings) with their size, the number of processes
+		mapping them, and the PSS of each of those processes.
+
+	shared
+		For each pair of the given processes, show how much resident memory they
+		share, and the memory that would be freed if all of them exited
+		(combined USS of the group). Requires root.
+
+	leaks
+		Sample memory of processes every --interval for --duration, fit a linear
+		trend to the USS, PSS and anonymous memory of each process, and report
+		processes with sustained growth, their growth rate, and confidence.
+
+	track
+		Re-read the smaps of a process every --interval, and print mappings
+		whose RSS, Private_Dirty or Swap grew or shrank, as well as mappings
+		created or unmapped since the previous sample. Stops after --count
+		samples, or when interrupted, and prints the changes since the start.
+
+	record
+		Append a sample of every process to a file every --interval, as JSON
+		lines or CSV with a time field, until --count samples were recorded or
+		interrupted. Rotates the file by --max-size and --max-age, and reopens it
+		on SIGHUP.
+
+	report
+		Read recordings, and report the minimum, median, 95th percentile and
+		maximum of PSS, USS, RSS and swap of each process, or of each --group of
+		processes (user, cgroup or command), when the maximum was reached, how
+		long the process was seen, and a sparkline of each. Sorts with -k and -r
+		like live mode, with sizes sorting by maximum, and filters by PID
+		arguments, --pids, and --where on the peaks of each process.
+		With --html, writes a self-contained page with charts of memory over
+		time, a sortable table and a treemap of peak PSS instead.
+
+	watch
+		Show memory of processes every --interval (default: 2s), like top,
+		with memory pressure of the system and the change of USS, PSS and RSS
+		since the previous sample. With --replay, show the samples of recordings
+		instead, played at --speed relative to the recording. PID arguments
+		and --where select the processes shown. Keys: q quit,
+		space pause or play, arrows step back and forward, g jump to a time,
+		+ and - change speed, k change sort key, r reverse the order.
 */
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
 	"os"
+	"os/signal"
+	"runtime"
+	"slices"
 	"strconv"
-	"strings"
+	"syscall"
+	"text/template"
+	"time"
 )
 
 const procDir = "/proc"
@@ -62,40 +235,161 @@ func allProcesses() []int {
 	return processes
 }
 
+// parses PID arguments, ignoring anything that is not a PID;
+// thread IDs resolve to their process
+func parsePids(args []string) []int {
+	pids := []int{}
+	seen := map[int]bool{}
+	for i := range args {
+		pid, err := strconv.Atoi(args[i])
+		if err != nil || pid <= 0 {
+			continue
+		}
+		// smaps_rollup of a thread is that of the whole process
+		if tgid, err := threadGroupID(pid); err == nil && tgid != pid {
+			fmt.Fprintf(os.Stderr, "note: %d is a thread of process %d, showing the process\n", pid, tgid)
+			pid = tgid
+		}
+		if !seen[pid] {
+			seen[pid] = true
+			pids = append(pids, pid)
+		}
+	}
+	return pids
+}
+
+// parses PID arguments like parsePids, rejecting anything that is not a PID
+func parsePidArgs(args []string) ([]int, error) {
+	for _, arg := range args {
+		if pid, err := strconv.Atoi(arg); err != nil || pid <= 0 {
+			return nil, fmt.Errorf("invalid PID: %s", arg)
+		}
+	}
+	return parsePids(args), nil
+}
+
 const flagHelpDescription = "print help information"
 const flagWideDescription = "always print full command line"
 const flagSortKeyDescription = "field to sort output on"
 const flagReverseSortDescription = "sort in reverse order"
 const flagHumanReadableDescription = "print sizes in human readable format"
+const flagJobsDescription = "number of collector workers"
+const flagTimeoutDescription = "per-process collection timeout"
+const flagThreadsDescription = "show thread counts and list threads"
+const flagAllTasksDescription = "also show kernel threads and zombies"
+const flagKernelThreadsDescription = "show only kernel threads"
+const flagColumnsDescription = "additional columns to show"
+const flagTHPDescription = "show huge page usage"
+const flagNUMADescription = "show memory per NUMA node"
+const flagOOMDescription = "show OOM scores and cgroup headroom"
+const flagOutputDescription = "output format: table, csv, json, html, pprof, folded, markdown, html-table, asciidoc"
+const flagExactDescription = "exact USS and PSS from pagemap (root)"
+const flagIdleDescription = "sample working set over this duration (root)"
+const flagBatchDescription = "print a sample every interval, with its time"
+const flagIntervalDescription = "time between samples"
+const flagCountDescription = "stop after this many samples, 0 for no limit"
+const flagFormatDescription = "print each process with a Go template"
+const flagFormatFileDescription = "print each process with a Go template read from a file"
+const flagWhereDescription = "show only processes matching an expression, e.g. 'pss > 200M && user == \"postgres\"'"
 
 func printUsage() {
 	fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [OPTION]... [PID]...\n", os.Args[0])
+	fmt.Fprintf(flag.CommandLine.Output(), "       %s summary [OPTION]...\n", os.Args[0])
+	fmt.Fprintf(flag.CommandLine.Output(), "       %s shm [OPTION]... [PID]...\n", os.Args[0])
+	fmt.Fprintf(flag.CommandLine.Output(), "       %s shared [OPTION]... PID...\n", os.Args[0])
+	fmt.Fprintf(flag.CommandLine.Output(), "       %s leaks [OPTION]... [PID]...\n", os.Args[0])
+	fmt.Fprintf(flag.CommandLine.Output(), "       %s track [OPTION]... PID\n", os.Args[0])
+	fmt.Fprintf(flag.CommandLine.Output(), "       %s record [OPTION]... -o FILE [PID]...\n", os.Args[0])
+	fmt.Fprintf(flag.CommandLine.Output(), "       %s report [OPTION]... FILE...\n", os.Args[0])
+	fmt.Fprintf(flag.CommandLine.Output(), "       %s watch [OPTION]... [PID]...\n", os.Args[0])
 	fmt.Fprintf(flag.CommandLine.Output(), `Options:
   --help                %s
   -w, --wide            %s
   -k, --key             %s
   -r, --reverse         %s
   -h, --human-readable  %s
+  -j, --jobs            %s
+  -t, --timeout         %s
+  -T, --threads         %s
+  -a, --all-tasks       %s
+  --kernel-threads      %s
+  -x, --exact           %s
+  -i, --idle            %s
+  --thp                 %s
+  --numa                %s
+  --oom                 %s
+  -o, --output          %s
+  -c, --columns         %s
+  -b, --batch           %s
+  --interval            %s (default 5s)
+  --count               %s
+  --format              %s
+  --format-file         %s
+  --where               %s
 `,
 		flagHelpDescription,
 		flagWideDescription,
 		flagSortKeyDescription,
 		flagReverseSortDescription,
-		flagHumanReadableDescription)
+		flagHumanReadableDescription,
+		flagJobsDescription,
+		flagTimeoutDescription,
+		flagThreadsDescription,
+		flagAllTasksDescription,
+		flagKernelThreadsDescription,
+		flagExactDescription,
+		flagIdleDescription,
+		flagTHPDescription,
+		flagNUMADescription,
+		flagOOMDescription,
+		flagOutputDescription,
+		flagColumnsDescription,
+		flagBatchDescription,
+		flagIntervalDescription,
+		flagCountDescription,
+		flagFormatDescription,
+		flagFormatFileDescription,
+		flagWhereDescription)
 }
 
 const (
 	ExitSuccess          = 0
 	ExitInvalidArguments = 1
+	ExitFailure          = 2
 )
 
+// subcommands, selected by the first argument
+var subcommands = map[string]func(args []string) int{
+	"summary": runSummary,
+	"shm":     runShm,
+	"shared":  runShared,
+	"leaks":   runLeaks,
+	"track":   runTrack,
+	"record":  runRecord,
+	"report":  runReport,
+	"watch":   runWatch,
+}
+
 func main() {
 	//trace.Start(os.Stderr)
 	//defer trace.Stop()
 
+	if len(os.Args) > 1 {
+		if subcommand, ok := subcommands[os.Args[1]]; ok {
+			os.Exit(subcommand(os.Args[2:]))
+		}
+	}
+	os.Exit(run())
+}
+
+// the main command, returning the exit code so that deferred cleanup runs
+func run() int {
 	// parse command line arguments
-	var help, wideOutput, reverseOrder, humanReadable bool
-	var sortKey string
+	var help, wideOutput, reverseOrder, humanReadable, threads bool
+	var allTasks, kernelThreads, exact, thp, numa, oom, batch bool
+	var sortKey, columnList, outputFormat, format, formatFile, where string
+	var jobs, count int
+	var timeout, idleInterval, interval time.Duration
 	flag.BoolVar(&help, "help", false, flagHelpDescription)
 	flag.BoolVar(&wideOutput, "wide", false, flagWideDescription)
 	flag.BoolVar(&wideOutput, "w", false, flagWideDescription)
@@ -105,60 +399,276 @@ func main() {
 	flag.BoolVar(&reverseOrder, "r", false, flagReverseSortDescription)
 	flag.BoolVar(&humanReadable, "human-readable", false, flagWideDescription)
 	flag.BoolVar(&humanReadable, "h", false, flagWideDescription)
+	flag.IntVar(&jobs, "jobs", runtime.NumCPU(), flagJobsDescription)
+	flag.IntVar(&jobs, "j", runtime.NumCPU(), flagJobsDescription)
+	flag.DurationVar(&timeout, "timeout", 0, flagTimeoutDescription)
+	flag.DurationVar(&timeout, "t", 0, flagTimeoutDescription)
+	flag.BoolVar(&threads, "threads", false, flagThreadsDescription)
+	flag.BoolVar(&threads, "T", false, flagThreadsDescription)
+	flag.BoolVar(&allTasks, "all-tasks", false, flagAllTasksDescription)
+	flag.BoolVar(&allTasks, "a", false, flagAllTasksDescription)
+	flag.BoolVar(&kernelThreads, "kernel-threads", false, flagKernelThreadsDescription)
+	flag.BoolVar(&exact, "exact", false, flagExactDescription)
+	flag.BoolVar(&exact, "x", false, flagExactDescription)
+	flag.DurationVar(&idleInterval, "idle", 0, flagIdleDescription)
+	flag.DurationVar(&idleInterval, "i", 0, flagIdleDescription)
+	flag.BoolVar(&thp, "thp", false, flagTHPDescription)
+	flag.BoolVar(&numa, "numa", false, flagNUMADescription)
+	flag.BoolVar(&oom, "oom", false, flagOOMDescription)
+	flag.StringVar(&outputFormat, "output", OutputTable, flagOutputDescription)
+	flag.StringVar(&outputFormat, "o", OutputTable, flagOutputDescription)
+	flag.StringVar(&columnList, "columns", "", flagColumnsDescription)
+	flag.StringVar(&columnList, "c", "", flagColumnsDescription)
+	flag.BoolVar(&batch, "batch", false, flagBatchDescription)
+	flag.BoolVar(&batch, "b", false, flagBatchDescription)
+	flag.DurationVar(&interval, "interval", 5*time.Second, flagIntervalDescription)
+	flag.IntVar(&count, "count", 0, flagCountDescription)
+	flag.StringVar(&format, "format", "", flagFormatDescription)
+	flag.StringVar(&formatFile, "format-file", "", flagFormatFileDescription)
+	flag.StringVar(&where, "where", "", flagWhereDescription)
 	flag.Usage = printUsage
 	flag.Parse()
 
 	if help {
 		printUsage()
-		os.Exit(ExitSuccess)
+		return ExitSuccess
 	}
 
 	// validate sort key
-	allowedSortKeys := map[string]bool{
-		"pid":     true,
-		"rss":     true,
-		"pss":     true,
-		"uss":     true,
-		"user":    true,
-		"command": true,
-	}
-	if !allowedSortKeys[strings.ToLower(sortKey)] {
+	if column, ok := findColumn(sortKey); !isSortKey(sortKey) {
 		fmt.Fprintf(os.Stderr, "error: unknown sort key: %s\n", sortKey)
-		os.Exit(ExitInvalidArguments)
+		return ExitInvalidArguments
+	} else if ok && column.idle && idleInterval == 0 {
+		fmt.Fprintf(os.Stderr, "error: sort key %s requires --idle\n", sortKey)
+		return ExitInvalidArguments
+	}
+
+	columns, err := parseColumns(columnList)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return ExitInvalidArguments
+	}
+	for _, column := range columns {
+		if column.idle && idleInterval == 0 {
+			fmt.Fprintf(os.Stderr, "error: column %s requires --idle\n", column.name)
+			return ExitInvalidArguments
+		}
+	}
+
+	if thp {
+		columns = appendColumns(columns, thpColumns)
+	}
+	if numa {
+		columns = appendColumns(columns, numaColumns())
+	}
+	if oom {
+		columns = appendColumns(columns, oomColumns)
+	}
+
+	if !slices.Contains(outputFormats, outputFormat) {
+		fmt.Fprintf(os.Stderr, "error: unknown output format: %s\n", outputFormat)
+		return ExitInvalidArguments
+	}
+	var outputTemplate *template.Template
+	if format != "" || formatFile != "" {
+		if format != "" && formatFile != "" || outputFormat != OutputTable {
+			fmt.Fprintf(os.Stderr, "error: --format and --format-file replace each other and --output\n")
+			return ExitInvalidArguments
+		}
+		if formatFile != "" {
+			contents, err := os.ReadFile(formatFile)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error: %v\n", err)
+				return ExitInvalidArguments
+			}
+			format = string(contents)
+		}
+		outputTemplate, err = parseTemplate(format)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			return ExitInvalidArguments
+		}
+		outputFormat = OutputTemplate
+	}
+	if batch && !slices.Contains(batchFormats, outputFormat) {
+		fmt.Fprintf(os.Stderr, "error: --batch does not support %s output\n", outputFormat)
+		return ExitInvalidArguments
+	}
+
+	if idleInterval < 0 {
+		fmt.Fprintf(os.Stderr, "error: invalid idle interval: %s\n", idleInterval)
+		return ExitInvalidArguments
+	}
+	if idleInterval > 0 {
+		exact = true
+		columns = appendColumns(columns, idleColumns)
+	}
+
+	if batch && (interval <= 0 || count < 0) {
+		fmt.Fprintf(os.Stderr, "error: interval must be positive and count not negative\n")
+		return ExitInvalidArguments
+	}
+
+	if jobs < 1 {
+		fmt.Fprintf(os.Stderr, "error: invalid number of jobs: %d\n", jobs)
+		return ExitInvalidArguments
+	}
+
+	if timeout < 0 {
+		fmt.Fprintf(os.Stderr, "error: invalid timeout: %s\n", timeout)
+		return ExitInvalidArguments
+	}
+
+	renderOptions := RenderOptions{
+		wide:          wideOutput,
+		humanReadable: humanReadable,
+		threads:       threads,
+		state:         allTasks || kernelThreads,
+		columns:       columns,
+		format:        outputFormat,
+		template:      outputTemplate,
+	}
+	if batch {
+		// for the time field, set again for each sample
+		renderOptions.time = time.Now()
+	}
+	var whereExpression *Expression
+	if where != "" {
+		whereExpression, err = parseExpression(where, outputFields(renderOptions))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: --where: %v\n", err)
+			return ExitInvalidArguments
+		}
 	}
 
 	// select PIDs
 	pids := []int{}
 	args := flag.Args()
 	if len(args) > 0 {
-		for i := range args {
-			pid, err := strconv.Atoi(args[i])
-			if err == nil && pid > 0 {
-				pids = append(pids, pid)
-			}
-		}
+		pids = parsePids(args)
 	} else {
 		pids = allProcesses()
 	}
 
-	// dispatch goroutines
-	pidSmemRollupParserChannelMap := dispatchSmemRollupParsers(pids)
-	pidOwnerChannelMap := dispatchPidOwners(pids)
-	comdlineChannelMap := dispatchCmdLineReaders(pids)
+	collectOptions := CollectOptions{jobs: jobs, timeout: timeout, tasks: threads, allTasks: allTasks || kernelThreads}
+	sortColumns := columns
+	if sortColumn, ok := findColumn(sortKey); ok {
+		sortColumns = append(slices.Clip(columns), sortColumn)
+	}
+	collectOptions.numa = columnsNeed(sortColumns, func(c Column) bool { return c.numa })
+	collectOptions.oom = columnsNeed(sortColumns, func(c Column) bool { return c.oom })
+	// the HTML treemap and profiles break down memory by unit and mapping
+	if outputFormat == OutputHTML || outputFormat == OutputPprof || outputFormat == OutputFolded {
+		collectOptions.mappings = true
+		collectOptions.oom = true
+	}
+
+	if exact {
+		kpages, err := openKPages()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: --exact requires root: %v\n", err)
+			return ExitFailure
+		}
+		defer kpages.Close()
+		collectOptions.exact = kpages
+		collectOptions.keepFrames = len(pids) > 1 && len(args) > 0 || idleInterval > 0
+	}
 
-	// collect results
+	var bitmap *IdleBitmap
+	if idleInterval > 0 {
+		bitmap, err = openIdleBitmap()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: --idle requires root and idle page tracking: %v\n", err)
+			return ExitFailure
+		}
+		defer bitmap.Close()
+	}
 
-	//rollups := reduceSmemRollupParsers(pidSmemRollupParserChannelMap)
-	rollups := reduceSmemRollupParsersSelect(pidSmemRollupParserChannelMap)
+	// collect, on interrupt stop collecting and print what we have;
+	// in batch mode, repeat every interval until count or interrupt
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	var ticker *time.Ticker
+	if batch {
+		ticker = time.NewTicker(interval)
+		defer ticker.Stop()
+	}
+	for iteration := 1; ; iteration++ {
+		sampled := time.Now()
+		processes := collectProcesses(ctx, pids, collectOptions)
+		if bitmap != nil {
+			err := sampleIdle(ctx, processes, collectOptions.exact, bitmap, idleInterval)
+			if errors.Is(err, context.Canceled) {
+				// interrupted while waiting, show what was collected
+				fmt.Fprintf(os.Stderr, "warning: interrupted before the working set was sampled, shown without it\n")
+				renderOptions.columns = slices.DeleteFunc(slices.Clone(columns), func(c Column) bool { return c.idle })
+			} else if err != nil {
+				fmt.Fprintf(os.Stderr, "error: idle page tracking: %v\n", err)
+				return ExitFailure
+			}
+		}
+		if !batch {
+			stop()
+		}
+		reportIncomplete(processes)
+		if batch {
+			renderOptions.time = sampled
+		}
 
-	pidOwnersMap := reducePidOwners(pidOwnerChannelMap)
-	//pidOwnersMap := reducePidOwnersSelect(pidOwnerChannelMap)
+		// filter
+		if kernelThreads {
+			processes = slices.DeleteFunc(processes, func(p Process) bool {
+				return !p.stat.isKernelThread()
+			})
+		}
+		if whereExpression != nil {
+			processes, err = filterProcesses(processes, whereExpression, outputFields(renderOptions))
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error: --where: %v\n", err)
+				return ExitInvalidArguments
+			}
+		}
 
-	cmdlineMap := reduceCmdLines(comdlineChannelMap)
+		// sort
+		sortProcesses(processes, sortKey, reverseOrder)
+
+		// output
+		isTable := outputFormat == OutputTable
+		if batch {
+			renderOptions.omitHeader = iteration > 1 && outputFormat == OutputCSV
+			if isTable {
+				if iteration > 1 {
+					fmt.Println()
+				}
+				fmt.Println(sampled.Format(time.RFC3339))
+			}
+		}
+		if thp && isTable {
+			fmt.Println(thpSystemLine(humanReadable))
+		}
+		if err := render(processes, renderOptions); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			return ExitFailure
+		}
 
-	// sort
-	sortRollups(rollups, pidOwnersMap, cmdlineMap, sortKey, reverseOrder)
+		if collectOptions.keepFrames && len(pids) > 1 && len(args) > 0 && isTable {
+			reportSetUnique(collectOptions.exact, processes, humanReadable)
+		}
 
-	// output
-	render(rollups, pidOwnersMap, cmdlineMap, wideOutput, humanReadable)
+		if !batch || iteration == count || ctx.Err() != nil {
+			break
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		if len(args) == 0 {
+			pids = allProcesses()
+		}
+		resetCgroupMemory()
+	}
+	return ExitSuccess
 }
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// a single memory mapping (VMA) from /proc/PID/smaps, see proc_pid_smaps(5)
+type Mapping struct {
+	start  uint64
+	end    uint64
+	perms  string
+	offset uint64
+	device string
+	inode  uint64
+	path   string         // file name, pseudo-path such as [heap], or empty for anonymous mappings
+	stats  map[string]int // in KiB, keyed by lower case name, same as SmemRollup
+}
+
+func (m Mapping) RSS() int {
+	return m.stats[StatRSS]
+}
+
+func (m Mapping) PSS() int {
+	return m.stats[StatPSS]
+}
+
+func (m Mapping) isShared() bool {
+	return strings.Contains(m.perms, "s")
+}
+
+// path without the " (deleted)" suffix of unlinked files
+func (m Mapping) name() string {
+	return strings.TrimSuffix(m.path, " (deleted)")
+}
+
+// kind of memory a mapping holds: heap, stack, shm, anon, file or other
+// (kernel provided mappings such as [vdso])
+func (m Mapping) class() string {
+	if _, ok := shmType(m); ok {
+		return "shm"
+	}
+	switch {
+	case m.path == "[heap]":
+		return "heap"
+	case strings.HasPrefix(m.path, "[stack"):
+		return "stack"
+	case m.path == "" || strings.HasPrefix(m.path, "[anon"):
+		return "anon"
+	case strings.HasPrefix(m.path, "["):
+		return "other"
+	}
+	return "file"
+}
+
+func readSmaps(pid int) (string, error) {
+	path := fmt.Sprintf("%s/%d/smaps", procDir, pid)
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return string(contents), nil
+}
+
+// parses /proc/PID/smaps: a header line per mapping, followed by
+// "Key: value kB" lines, and a VmFlags line that is ignored
+func parseSmaps(contents string) []Mapping {
+	var mappings []Mapping
+	for _, line := range strings.Split(contents, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if strings.Contains(fields[0], "-") && !strings.HasSuffix(fields[0], ":") {
+			if mapping, err := parseMappingHeader(line); err == nil {
+				mappings = append(mappings, mapping)
+			}
+			continue
+		}
+		if len(mappings) == 0 || len(fields) < 2 {
+			continue
+		}
+		key, found := strings.CutSuffix(fields[0], ":")
+		if !found {
+			continue
+		}
+		if value, err := strconv.Atoi(fields[1]); err == nil {
+			mappings[len(mappings)-1].stats[strings.ToLower(key)] = value
+		}
+	}
+	return mappings
+}
+
+// parses "start-end perms offset dev inode [path]"
+func parseMappingHeader(line string) (Mapping, error) {
+	// path may contain spaces, so only the first five fields are split off
+	fields := make([]string, 0, 5)
+	rest := line
+	for range 5 {
+		field, remainder, _ := strings.Cut(strings.TrimLeft(rest, " "), " ")
+		fields = append(fields, field)
+		rest = remainder
+	}
+	if fields[4] == "" {
+		return Mapping{}, fmt.Errorf("short mapping header: %s", line)
+	}
+	startString, endString, _ := strings.Cut(fields[0], "-")
+	start, err := strconv.ParseUint(startString, 16, 64)
+	if err != nil {
+		return Mapping{}, err
+	}
+	end, err := strconv.ParseUint(endString, 16, 64)
+	if err != nil {
+		return Mapping{}, err
+	}
+	offset, err := strconv.ParseUint(fields[2], 16, 64)
+	if err != nil {
+		return Mapping{}, err
+	}
+	inode, err := strconv.ParseUint(fields[4], 10, 64)
+	if err != nil {
+		return Mapping{}, err
+	}
+	path := strings.TrimLeft(rest, " ")
+	return Mapping{start, end, fields[1], offset, fields[3], inode, path, map[string]int{}}, nil
+}
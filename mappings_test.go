@@ -0,0 +1,115 @@
+package main
+
+import (
+	"maps"
+	"testing"
+)
+
+const testSmaps = `55d4c8a00000-55d4c8a2c000 r--p 00000000 fd:01 1837213                    /usr/bin/bash
+Size:                176 kB
+KernelPageSize:        4 kB
+Rss:                 176 kB
+Pss:                  35 kB
+Pss_Dirty:             0 kB
+Shared_Clean:        176 kB
+Shared_Dirty:          0 kB
+Private_Clean:         0 kB
+Private_Dirty:         0 kB
+Anonymous:             0 kB
+Swap:                  0 kB
+THPeligible:    0
+VmFlags: rd mr mw me dw sd
+55d4c9e1f000-55d4c9f9a000 rw-p 00000000 00:00 0                          [heap]
+Size:               1516 kB
+Rss:                1420 kB
+Pss:                1420 kB
+Private_Dirty:      1420 kB
+Anonymous:          1420 kB
+Swap:                 12 kB
+VmFlags: rd wr mr mw me ac sd
+7f3a10000000-7f3a10021000 rw-p 00000000 00:00 0
+Size:                132 kB
+Rss:                   8 kB
+Private_Dirty:         8 kB
+Anonymous:             8 kB
+VmFlags: rd wr mr mw me nr sd
+7f3a12000000-7f3a16000000 rw-s 00000000 00:01 2054                       /dev/shm/shared buffer (deleted)
+Size:              65536 kB
+Rss:                4096 kB
+Pss:                2048 kB
+Shared_Dirty:       4096 kB
+VmFlags: rd wr sh mr mw me ms sd
+ffffffffff600000-ffffffffff601000 --xp 00000000 00:00 0                  [vsyscall]
+Size:                  4 kB
+Rss:                   0 kB
+VmFlags: ex
+`
+
+func TestParseSmaps(t *testing.T) {
+	mappings := parseSmaps(testSmaps)
+	want := []struct {
+		start, end uint64
+		perms      string
+		device     string
+		inode      uint64
+		path       string
+		class      string
+		stats      map[string]int
+	}{
+		{0x55d4c8a00000, 0x55d4c8a2c000, "r--p", "fd:01", 1837213, "/usr/bin/bash", "file", map[string]int{
+			"size": 176, "kernelpagesize": 4, "rss": 176, "pss": 35, "pss_dirty": 0, "shared_clean": 176, "shared_dirty": 0,
+			"private_clean": 0, "private_dirty": 0, "anonymous": 0, "swap": 0, "thpeligible": 0,
+		}},
+		{0x55d4c9e1f000, 0x55d4c9f9a000, "rw-p", "00:00", 0, "[heap]", "heap", map[string]int{
+			"size": 1516, "rss": 1420, "pss": 1420, "private_dirty": 1420, "anonymous": 1420, "swap": 12,
+		}},
+		{0x7f3a10000000, 0x7f3a10021000, "rw-p", "00:00", 0, "", "anon", map[string]int{
+			"size": 132, "rss": 8, "private_dirty": 8, "anonymous": 8,
+		}},
+		{0x7f3a12000000, 0x7f3a16000000, "rw-s", "00:01", 2054, "/dev/shm/shared buffer (deleted)", "shm", map[string]int{
+			"size": 65536, "rss": 4096, "pss": 2048, "shared_dirty": 4096,
+		}},
+		{0xffffffffff600000, 0xffffffffff601000, "--xp", "00:00", 0, "[vsyscall]", "other", map[string]int{
+			"size": 4, "rss": 0,
+		}},
+	}
+	if len(mappings) != len(want) {
+		t.Fatalf("parseSmaps = %d mappings, want %d: %+v", len(mappings), len(want), mappings)
+	}
+	for i, m := range mappings {
+		w := want[i]
+		if m.start != w.start || m.end != w.end || m.perms != w.perms || m.device != w.device || m.inode != w.inode || m.path != w.path {
+			t.Errorf("mapping %d = %x-%x %s %s %d %q, want %x-%x %s %s %d %q", i,
+				m.start, m.end, m.perms, m.device, m.inode, m.path,
+				w.start, w.end, w.perms, w.device, w.inode, w.path)
+		}
+		if class := m.class(); class != w.class {
+			t.Errorf("mapping %d class = %s, want %s", i, class, w.class)
+		}
+		if !maps.Equal(m.stats, w.stats) {
+			t.Errorf("mapping %d stats = %v, want %v", i, m.stats, w.stats)
+		}
+	}
+	if name := mappings[3].name(); name != "/dev/shm/shared buffer" {
+		t.Errorf("name of a deleted file = %q, want the path without (deleted)", name)
+	}
+}
+
+func TestParseSmapsMalformed(t *testing.T) {
+	// counters before the first header and malformed headers are skipped
+	contents := `Rss: 4 kB
+zzzz-1000 rw-p 00000000 00:00 0
+Rss: 8 kB
+1000-2000 rw-p 00000000 00:00
+1000-2000 rw-p 00000000 00:00 0
+Rss: 12 kB
+Bogus
+`
+	mappings := parseSmaps(contents)
+	if len(mappings) != 1 || mappings[0].start != 0x1000 || mappings[0].RSS() != 12 {
+		t.Errorf("parseSmaps = %+v, want the one well formed mapping with Rss 12", mappings)
+	}
+	if mappings := parseSmaps(""); len(mappings) != 0 {
+		t.Errorf("parseSmaps of nothing = %+v, want none", mappings)
+	}
+}
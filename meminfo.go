@@ -0,0 +1,40 @@
+package main
+
+import (
+	"os"
+	"strconv"
+	"strings"
+)
+
+// reads /proc/meminfo, see proc_meminfo(5);
+// values are in KiB, except HugePages_* which are page counts
+func readMeminfo() (map[string]int, error) {
+	contents, err := os.ReadFile(procDir + "/meminfo")
+	if err != nil {
+		return nil, err
+	}
+	return parseMeminfo(string(contents)), nil
+}
+
+func parseMeminfo(contents string) map[string]int {
+	meminfo := map[string]int{}
+	for _, line := range strings.Split(contents, "\n") {
+		key, value, found := strings.Cut(line, ":")
+		if !found {
+			continue
+		}
+		value = strings.TrimSuffix(strings.TrimSpace(value), " kB")
+		if n, err := strconv.Atoi(value); err == nil {
+			meminfo[key] = n
+		}
+	}
+	return meminfo
+}
+
+// total memory in the hugetlb pool, in KiB
+func hugetlbTotal(meminfo map[string]int) int {
+	if hugetlb, ok := meminfo["Hugetlb"]; ok {
+		return hugetlb
+	}
+	return meminfo["HugePages_Total"] * meminfo["Hugepagesize"]
+}
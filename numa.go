@@ -0,0 +1,195 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const nodeDir = "/sys/devices/system/node"
+
+// per-process NUMA placement from /proc/PID/numa_maps, see numa(7)
+type NumaInfo struct {
+	nodes  map[int]int // resident memory per node, in KiB
+	policy string      // memory policy covering most resident memory
+	mixed  bool        // other policies are in use as well
+}
+
+// lists the NUMA nodes of the system
+func numaNodes() []int {
+	files, err := os.ReadDir(nodeDir)
+	if err != nil {
+		return []int{0}
+	}
+	var nodes []int
+	for _, file := range files {
+		if n, ok := strings.CutPrefix(file.Name(), "node"); ok {
+			if node, err := strconv.Atoi(n); err == nil {
+				nodes = append(nodes, node)
+			}
+		}
+	}
+	slices.Sort(nodes)
+	if len(nodes) == 0 {
+		return []int{0}
+	}
+	return nodes
+}
+
+// parses a list such as 0-3,8,10-11
+func parseCPUList(list string) []int {
+	var cpus []int
+	for _, part := range strings.Split(strings.TrimSpace(list), ",") {
+		first, last, isRange := strings.Cut(part, "-")
+		from, err := strconv.Atoi(first)
+		if err != nil {
+			continue
+		}
+		to := from
+		if isRange {
+			if to, err = strconv.Atoi(last); err != nil {
+				continue
+			}
+		}
+		for cpu := from; cpu <= to; cpu++ {
+			cpus = append(cpus, cpu)
+		}
+	}
+	return cpus
+}
+
+// maps each CPU to its NUMA node, read on first use
+var cpuNodes = sync.OnceValue(func() map[int]int {
+	nodes := map[int]int{}
+	for _, node := range numaNodes() {
+		list, err := os.ReadFile(fmt.Sprintf("%s/node%d/cpulist", nodeDir, node))
+		if err != nil {
+			continue
+		}
+		for _, cpu := range parseCPUList(string(list)) {
+			nodes[cpu] = node
+		}
+	}
+	return nodes
+})
+
+func readNumaMaps(pid int) (NumaInfo, error) {
+	contents, err := os.ReadFile(fmt.Sprintf("%s/%d/numa_maps", procDir, pid))
+	if err != nil {
+		return NumaInfo{}, err
+	}
+	return parseNumaMaps(string(contents)), nil
+}
+
+// parses lines such as
+// 7f2c4a000000 bind:1 anon=512 dirty=512 N1=512 kernelpagesize_kB=4
+func parseNumaMaps(contents string) NumaInfo {
+	info := NumaInfo{nodes: map[int]int{}}
+	policies := map[string]int{}
+	for _, line := range strings.Split(contents, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		pageSize := 4
+		pages := map[int]int{}
+		for _, field := range fields[2:] {
+			key, value, found := strings.Cut(field, "=")
+			if !found {
+				continue
+			}
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				continue
+			}
+			if key == "kernelpagesize_kB" {
+				pageSize = n
+			} else if node, ok := strings.CutPrefix(key, "N"); ok {
+				if node, err := strconv.Atoi(node); err == nil {
+					pages[node] += n
+				}
+			}
+		}
+		resident := 0
+		for node, n := range pages {
+			info.nodes[node] += n * pageSize
+			resident += n * pageSize
+		}
+		policies[fields[1]] += resident
+	}
+
+	for policy, resident := range policies {
+		if info.policy == "" || resident > policies[info.policy] ||
+			(resident == policies[info.policy] && policy < info.policy) {
+			info.policy = policy
+		}
+	}
+	info.mixed = len(policies) > 1
+	return info
+}
+
+// resident memory on nodes other than the one the process last ran on
+func remoteMemory(p Process) int {
+	local, ok := cpuNodes()[p.stat.processor]
+	if !ok {
+		return 0
+	}
+	remote := 0
+	for node, size := range p.numa.nodes {
+		if node != local {
+			remote += size
+		}
+	}
+	return remote
+}
+
+func numaNodeColumn(node int) Column {
+	return Column{
+		name:   fmt.Sprintf("n%d", node),
+		header: fmt.Sprintf("N%d", node),
+		memory: true,
+		numa:   true,
+		value:  func(p Process) int { return p.numa.nodes[node] },
+	}
+}
+
+func parseNodeColumnName(name string) (int, bool) {
+	n, ok := strings.CutPrefix(strings.ToLower(name), "n")
+	if !ok {
+		return 0, false
+	}
+	node, err := strconv.Atoi(n)
+	return node, err == nil && node >= 0
+}
+
+var numaPolicyColumn = Column{
+	name:   "policy",
+	header: "Policy",
+	numa:   true,
+	text: func(p Process) string {
+		if p.numa.mixed {
+			return p.numa.policy + "+"
+		}
+		return p.numa.policy
+	},
+}
+
+var numaRemoteColumn = Column{
+	name:   "remote",
+	header: "Remote",
+	memory: true,
+	numa:   true,
+	value:  remoteMemory,
+}
+
+// columns shown with --numa: one per node, remote memory, and the policy
+func numaColumns() []Column {
+	var columns []Column
+	for _, node := range numaNodes() {
+		columns = append(columns, numaNodeColumn(node))
+	}
+	return append(columns, numaRemoteColumn, numaPolicyColumn)
+}
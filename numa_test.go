@@ -0,0 +1,82 @@
+package main
+
+import (
+	"maps"
+	"slices"
+	"testing"
+)
+
+func TestParseNumaMaps(t *testing.T) {
+	contents := `55d4c8a00000 default file=/usr/bin/bash mapped=44 mapmax=3 N0=44 kernelpagesize_kB=4
+55d4c9e1f000 default heap anon=355 dirty=355 N0=300 N1=55 kernelpagesize_kB=4
+7f2c4a000000 bind:1 anon=512 dirty=512 N1=512 kernelpagesize_kB=4
+7f2c60000000 interleave:0-1 anon=4 dirty=4 N0=2 N1=2 kernelpagesize_kB=2048
+7f2c80000000 default
+7ffc1e5d4000 default stack anon=33 dirty=33 N0=33 kernelpagesize_kB=4
+`
+	info := parseNumaMaps(contents)
+	wantNodes := map[int]int{
+		0: (44+300+33)*4 + 2*2048,
+		1: (55+512)*4 + 2*2048,
+	}
+	if !maps.Equal(info.nodes, wantNodes) {
+		t.Errorf("nodes = %v, want %v", info.nodes, wantNodes)
+	}
+	// huge pages of the interleaved mapping outweigh the rest
+	if info.policy != "interleave:0-1" || !info.mixed {
+		t.Errorf("policy = %s, mixed %v, want interleave:0-1 mixed with others", info.policy, info.mixed)
+	}
+
+	info = parseNumaMaps("7f2c4a000000 bind:1 anon=2 N1=2\n7f2c4b000000 bind:1 anon=1 N1=1\n")
+	if info.policy != "bind:1" || info.mixed || info.nodes[1] != 12 {
+		t.Errorf("single policy = %+v, want bind:1 not mixed with 12 KiB on node 1", info)
+	}
+
+	// policies with the same resident memory are chosen by name, so that
+	// the column does not change between samples
+	info = parseNumaMaps("1000 preferred:0 N0=1\n2000 default N0=1\n")
+	if info.policy != "default" || !info.mixed {
+		t.Errorf("tied policies = %+v, want default", info)
+	}
+
+	if info := parseNumaMaps(""); len(info.nodes) != 0 || info.policy != "" {
+		t.Errorf("parseNumaMaps of nothing = %+v", info)
+	}
+}
+
+func TestParseCPUList(t *testing.T) {
+	tests := []struct {
+		list string
+		want []int
+	}{
+		{"0-3,8,10-11\n", []int{0, 1, 2, 3, 8, 10, 11}},
+		{"5", []int{5}},
+		{"", nil},
+		{"x,2-y,4", []int{4}},
+	}
+	for _, test := range tests {
+		if got := parseCPUList(test.list); !slices.Equal(got, test.want) {
+			t.Errorf("parseCPUList(%q) = %v, want %v", test.list, got, test.want)
+		}
+	}
+}
+
+func TestParseNodeColumnName(t *testing.T) {
+	tests := []struct {
+		name string
+		node int
+		ok   bool
+	}{
+		{"n0", 0, true},
+		{"N12", 12, true},
+		{"n-1", 0, false},
+		{"node1", 0, false},
+		{"pss", 0, false},
+	}
+	for _, test := range tests {
+		node, ok := parseNodeColumnName(test.name)
+		if ok != test.ok || ok && node != test.node {
+			t.Errorf("parseNodeColumnName(%q) = %d, %v, want %d, %v", test.name, node, ok, test.node, test.ok)
+		}
+	}
+}
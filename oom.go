@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// OOM killer state of a process and its cgroup, see proc_pid_oom_score(5)
+type OOMInfo struct {
+	score    int // badness, the process with the highest score is killed first
+	scoreAdj int
+	cgroup   string
+	memory   CgroupMemory
+}
+
+func readProcInt(pid int, name string) (int, error) {
+	contents, err := os.ReadFile(fmt.Sprintf("%s/%d/%s", procDir, pid, name))
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(strings.TrimSpace(string(contents)))
+}
+
+func readOOMInfo(pid int) (OOMInfo, error) {
+	score, err := readProcInt(pid, "oom_score")
+	if err != nil {
+		return OOMInfo{}, err
+	}
+	scoreAdj, err := readProcInt(pid, "oom_score_adj")
+	if err != nil {
+		return OOMInfo{}, err
+	}
+	info := OOMInfo{score: score, scoreAdj: scoreAdj}
+	if cgroup, err := readCgroupPath(pid); err == nil {
+		info.cgroup = cgroup
+		info.memory = readCgroupMemory(cgroup)
+	}
+	return info, nil
+}
+
+func isLimited(p Process) bool {
+	return p.oom.memory.limited
+}
+
+// columns shown with --oom
+var oomColumns = []Column{
+	{name: "oom", header: "OOM", oom: true, value: func(p Process) int { return p.oom.score }},
+	{name: "oom-adj", header: "OOM Adj", oom: true, value: func(p Process) int { return p.oom.scoreAdj }},
+	{name: "cg-current", header: "CG Current", memory: true, oom: true, value: func(p Process) int { return p.oom.memory.current }},
+	{name: "cg-max", header: "CG Max", memory: true, oom: true, available: isLimited,
+		value: func(p Process) int {
+			if !p.oom.memory.limited {
+				return 0
+			}
+			return p.oom.memory.limit
+		}},
+	// unlimited sorts after any limit
+	{name: "headroom", header: "Headroom", memory: true, oom: true, available: isLimited,
+		value: func(p Process) int { return p.oom.memory.headroom }},
+}
+
+var cgroupColumn = Column{name: "cgroup", header: "Cgroup", oom: true, text: func(p Process) string { return p.oom.cgroup }}
@@ -1,9 +1,16 @@
 package main
 
 import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
 	"fmt"
+	"io"
 	"os"
 	"strconv"
+	"strings"
+	"text/template"
+	"time"
 	"unicode/utf8"
 
 	"github.com/dustin/go-humanize"
@@ -21,6 +28,47 @@ func kiloBytesToString(value int, humanReadable bool) string {
 	return fmt.Sprintf("%d", value)
 }
 
+// render a memory column, or a placeholder if collection did not finish
+func memoryToString(process Process, value int, humanReadable bool) string {
+	if process.incomplete {
+		return "?"
+	}
+	return kiloBytesToString(value, humanReadable)
+}
+
+// warn on stderr about rows that could not be collected in full
+func reportIncomplete(processes []Process) {
+	incomplete := 0
+	for _, process := range processes {
+		if process.incomplete {
+			incomplete++
+		}
+	}
+	if incomplete > 0 {
+		fmt.Fprintf(os.Stderr, "warning: collection did not finish for %d processes, shown with ?\n", incomplete)
+	}
+}
+
+// print memory mapped only by the given processes, see KPages.setUnique
+func reportSetUnique(kpages *KPages, processes []Process, humanReadable bool) {
+	frames := make([]PageFrames, 0, len(processes))
+	for _, process := range processes {
+		if process.frames != nil {
+			frames = append(frames, process.frames)
+		}
+	}
+	if len(frames) < 2 {
+		return
+	}
+	unique, err := kpages.setUnique(frames)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return
+	}
+	fmt.Printf("\nMapped only by these %d processes: %s\n",
+		len(frames), kiloBytesToString(int(unique)*pageSizeKiB, humanReadable))
+}
+
 // try to infer terminal width
 func terminalWidth() int {
 	// Try stdout
@@ -60,55 +108,165 @@ func terminalWidth() int {
 	return 80
 }
 
-// calculate width of columns other than command line
-func otherColumnsWidth(rollups []SmemRollup, pidOwnersMap map[int]PidOwner, humanReadable bool) int {
-	spacingWidth := 11
-	pidWidth := 3
-	userWidth := 4
-	ussWidth := 3
-	pssWidth := 3
-	rssWidth := 3
+// output formats
+const (
+	OutputTable  = "table"
+	OutputCSV    = "csv"
+	OutputJSON   = "json"
+	OutputHTML   = "html"
+	OutputPprof  = "pprof"
+	OutputFolded = "folded"
+	// tables for documents
+	OutputMarkdown  = "markdown"
+	OutputHTMLTable = "html-table"
+	OutputAsciiDoc  = "asciidoc"
+	// set by --format, rather than --output
+	OutputTemplate = "template"
+)
 
-	for _, rollup := range rollups {
-		l := len(fmt.Sprintf("%d", rollup.PID()))
-		if l > pidWidth {
-			pidWidth = l
-		}
+var outputFormats = []string{OutputTable, OutputCSV, OutputJSON, OutputHTML, OutputPprof, OutputFolded,
+	OutputMarkdown, OutputHTMLTable, OutputAsciiDoc}
 
-		user := pidOwnersMap[rollup.PID()].username
-		if user == "" {
-			user = strconv.Itoa(pidOwnersMap[rollup.PID()].uid)
-		}
-		l = len(user)
-		if l > userWidth {
-			userWidth = l
-		}
+// formats that can be repeated in batch mode
+var batchFormats = []string{OutputTable, OutputCSV, OutputJSON, OutputMarkdown, OutputHTMLTable, OutputAsciiDoc, OutputTemplate}
 
-		uss := rollup.USS()
-		l = len(kiloBytesToString(uss, humanReadable))
-		if l > ussWidth {
-			ussWidth = l
-		}
+// RFC 3339 with milliseconds, since samples may be taken more than once a second
+const sampleTimeFormat = "2006-01-02T15:04:05.000Z07:00"
+
+// how to render the output table
+type RenderOptions struct {
+	wide          bool // always print the full command line
+	humanReadable bool // print sizes in human readable format
+	threads       bool // print thread counts and list tasks under each process
+	state         bool // print process state
+	columns       []Column
+	format        string
+	time          time.Time // when the processes were sampled, a field in batch and recorded output
+	omitHeader    bool      // leave out the CSV header, after the first sample
+	template      *template.Template
+}
+
+// a field of the output, a column of the table
+type Field struct {
+	name   string // key in machine readable output
+	header string
+	align  text.Align
+	value  func(Process) any    // raw value, for machine readable output
+	cell   func(Process) string // table cell
+}
 
-		pss := rollup.PSS()
-		l = len(kiloBytesToString(pss, humanReadable))
-		if l > pssWidth {
-			pssWidth = l
+// the fields to output, in order; the command line is always last
+func outputFields(options RenderOptions) []Field {
+	memoryField := func(name, header string, value func(Process) int) Field {
+		return Field{name, header, text.AlignRight,
+			func(p Process) any {
+				if p.incomplete {
+					return nil
+				}
+				return value(p)
+			},
+			func(p Process) string { return memoryToString(p, value(p), options.humanReadable) }}
+	}
+
+	var fields []Field
+	if !options.time.IsZero() && options.format != OutputTable {
+		sampled := options.time.Format(sampleTimeFormat)
+		fields = append(fields, Field{"time", "Time", text.AlignLeft,
+			func(p Process) any { return sampled },
+			func(p Process) string { return sampled }})
+	}
+	fields = append(fields,
+		Field{"pid", "PID", text.AlignRight,
+			func(p Process) any { return p.PID() },
+			func(p Process) string { return strconv.Itoa(p.PID()) }},
+		Field{"user", "User", text.AlignLeft,
+			func(p Process) any { return p.User() },
+			Process.User})
+	if options.state {
+		fields = append(fields, Field{"state", "State", text.AlignLeft,
+			func(p Process) any { return p.State() },
+			Process.State})
+	}
+	if options.threads {
+		fields = append(fields, Field{"threads", "Thr", text.AlignRight,
+			func(p Process) any { return p.Threads() },
+			func(p Process) string { return strconv.Itoa(p.Threads()) }})
+	}
+	fields = append(fields,
+		memoryField("uss", "USS", Process.USS),
+		memoryField("pss", "PSS", Process.PSS),
+		memoryField("rss", "RSS", Process.RSS))
+	for _, column := range options.columns {
+		align := text.AlignRight
+		if column.text != nil {
+			align = text.AlignLeft
 		}
+		fields = append(fields, Field{column.name, column.header, align,
+			func(p Process) any { return columnValue(p, column) },
+			func(p Process) string { return columnToString(p, column, options.humanReadable) }})
+	}
+	return append(fields, Field{"command", "Command", text.AlignLeft,
+		func(p Process) any { return p.Command() },
+		Process.Command})
+}
 
-		rss := rollup.RSS()
-		l = len(kiloBytesToString(rss, humanReadable))
-		if l > rssWidth {
-			rssWidth = l
+// calculate width of columns other than command line
+func otherColumnsWidth(processes []Process, fields []Field, options RenderOptions) int {
+	others := fields[:len(fields)-1]
+	// leading space, and two spaces between columns
+	width := 1 + 2*len(others)
+	for i, field := range others {
+		fieldWidth := len(field.header)
+		for _, process := range processes {
+			fieldWidth = max(fieldWidth, utf8.RuneCountInString(field.cell(process)))
+			// task IDs go in the PID column
+			if i == 0 && options.threads {
+				for _, task := range process.tasks {
+					fieldWidth = max(fieldWidth, len(strconv.Itoa(task.tid)))
+				}
+			}
 		}
+		width += fieldWidth
+	}
+	return width
+}
+
+// truncate command to width, unless output is wide
+func truncateCommand(command string, width int, isWideOutput bool) string {
+	if !isWideOutput && utf8.RuneCountInString(command) > width {
+		return string([]rune(command)[0:width])
 	}
+	return command
+}
 
-	return spacingWidth + pidWidth + userWidth + ussWidth + pssWidth + rssWidth
+// render processes to stdout in the selected format
+func render(processes []Process, options RenderOptions) error {
+	fields := outputFields(options)
+	switch options.format {
+	case OutputCSV:
+		renderCSV(os.Stdout, processes, fields, options)
+	case OutputJSON:
+		renderJSON(os.Stdout, processes, fields, options)
+	case OutputHTML:
+		renderHTML(os.Stdout, snapshotPage(processes, fields, options))
+	case OutputPprof:
+		renderPprof(os.Stdout, processes)
+	case OutputFolded:
+		renderFolded(os.Stdout, processes)
+	case OutputMarkdown, OutputHTMLTable, OutputAsciiDoc:
+		renderDocument(os.Stdout, processes, fields, options)
+	case OutputTemplate:
+		return renderTemplate(os.Stdout, processes, fields, options)
+	default:
+		renderTable(os.Stdout, processes, fields, options)
+	}
+	return nil
 }
 
-// render output table to stdout
-func render(rollups []SmemRollup, pidOwnersMap map[int]PidOwner, cmdlineMap map[int]string, isWideOutput bool, humanReadable bool) {
-	cmdWidth := terminalWidth() - otherColumnsWidth(rollups, pidOwnersMap, humanReadable)
+// render output table
+func renderTable(out io.Writer, processes []Process, fields []Field, options RenderOptions) {
+	isWideOutput := options.wide
+	cmdWidth := terminalWidth() - otherColumnsWidth(processes, fields, options)
 	if cmdWidth < 7 {
 		cmdWidth = 7
 		isWideOutput = true
@@ -116,37 +274,228 @@ func render(rollups []SmemRollup, pidOwnersMap map[int]PidOwner, cmdlineMap map[
 
 	t := table.NewWriter()
 
-	t.SetOutputMirror(os.Stdout)
+	t.SetOutputMirror(out)
 	t.SuppressTrailingSpaces()
-	t.SetColumnConfigs([]table.ColumnConfig{
-		{Number: 1, Align: text.AlignRight, AlignFooter: text.AlignRight, AlignHeader: text.AlignRight},
-		{Number: 2, Align: text.AlignLeft, AlignFooter: text.AlignLeft, AlignHeader: text.AlignLeft},
-		{Number: 3, Align: text.AlignRight, AlignFooter: text.AlignRight, AlignHeader: text.AlignRight},
-		{Number: 4, Align: text.AlignRight, AlignFooter: text.AlignRight, AlignHeader: text.AlignRight},
-		{Number: 5, Align: text.AlignRight, AlignFooter: text.AlignRight, AlignHeader: text.AlignRight},
-		{Number: 6, Align: text.AlignLeft, AlignFooter: text.AlignLeft, AlignHeader: text.AlignLeft},
-	})
+
+	header := table.Row{}
+	columnConfigs := make([]table.ColumnConfig, len(fields))
+	for i, field := range fields {
+		header = append(header, field.header)
+		columnConfigs[i] = table.ColumnConfig{Number: i + 1, Align: field.align, AlignFooter: field.align, AlignHeader: field.align}
+	}
+	t.SetColumnConfigs(columnConfigs)
 	t.Style().Options.DrawBorder = false
 	t.Style().Options.SeparateHeader = false
 	t.Style().Options.SeparateColumns = false
 	t.Style().Options.SeparateRows = false
 
-	t.AppendHeader(table.Row{"PID", "User", "USS", "PSS", "RSS", "Command"})
-	for _, rollup := range rollups {
-		pid := rollup.PID()
-		uss := kiloBytesToString((rollup.USS()), humanReadable)
-		pss := kiloBytesToString((rollup.PSS()), humanReadable)
-		rss := kiloBytesToString(rollup.RSS(), humanReadable)
-		user := pidOwnersMap[pid].username
-		if user == "" {
-			user = strconv.Itoa(pidOwnersMap[pid].uid)
+	t.AppendHeader(header)
+	for _, process := range processes {
+		row := table.Row{}
+		for _, field := range fields[:len(fields)-1] {
+			row = append(row, field.cell(process))
 		}
-		command := cmdlineMap[pid]
-		if !isWideOutput && utf8.RuneCountInString(command) > cmdWidth {
-			command = string([]rune(cmdlineMap[pid])[0:cmdWidth])
+		t.AppendRow(append(row, truncateCommand(process.Command(), cmdWidth, isWideOutput)))
+
+		if !options.threads {
+			continue
+		}
+		// tasks share the address space of the process, so only their names are shown
+		for _, task := range process.tasks {
+			name := truncateCommand(" \\_ "+task.name, cmdWidth, isWideOutput)
+			taskRow := table.Row{task.tid}
+			for range len(fields) - 2 {
+				taskRow = append(taskRow, "")
+			}
+			t.AppendRow(append(taskRow, name))
 		}
-		t.AppendRow(table.Row{pid, user, uss, pss, rss, command})
 	}
 
 	t.Render()
 }
+
+// escapes characters that GitHub flavored Markdown would take as formatting
+// or HTML; go-pretty escapes pipes and line breaks
+var markdownEscaper = strings.NewReplacer(
+	`\`, `\\`, "`", "\\`", "*", `\*`, "_", `\_`, "[", `\[`, "]", `\]`,
+	"<", `\<`, ">", `\>`, "~", `\~`, "&", `\&`, "#", `\#`)
+
+// render a table for pasting into a Markdown, HTML or AsciiDoc document,
+// with the same cells as the table but full command lines
+func renderDocument(out io.Writer, processes []Process, fields []Field, options RenderOptions) {
+	escape := func(s string) string { return s }
+	if options.format == OutputMarkdown {
+		escape = markdownEscaper.Replace
+	}
+
+	var rows [][]string
+	for _, process := range processes {
+		row := make([]string, len(fields))
+		for i, field := range fields {
+			row[i] = escape(field.cell(process))
+		}
+		rows = append(rows, row)
+
+		if !options.threads {
+			continue
+		}
+		for _, task := range process.tasks {
+			taskRow := make([]string, len(fields))
+			taskRow[0] = strconv.Itoa(task.tid)
+			taskRow[len(fields)-1] = escape("\\_ " + task.name)
+			rows = append(rows, taskRow)
+		}
+	}
+
+	if options.format == OutputAsciiDoc {
+		renderAsciiDoc(out, rows, fields)
+		return
+	}
+
+	t := table.NewWriter()
+	header := table.Row{}
+	columnConfigs := make([]table.ColumnConfig, len(fields))
+	for i, field := range fields {
+		header = append(header, field.header)
+		columnConfigs[i] = table.ColumnConfig{Number: i + 1, Align: field.align, AlignHeader: field.align}
+	}
+	t.SetColumnConfigs(columnConfigs)
+	t.AppendHeader(header)
+	for _, row := range rows {
+		r := make(table.Row, len(row))
+		for i, cell := range row {
+			r[i] = cell
+		}
+		t.AppendRow(r)
+	}
+
+	if options.format == OutputMarkdown {
+		io.WriteString(out, t.RenderMarkdown()+"\n")
+	} else {
+		io.WriteString(out, t.RenderHTML()+"\n")
+	}
+}
+
+// render rows as an AsciiDoc table; text columns are literal, so that
+// command lines are not formatted, and cell separators in them are escaped
+func renderAsciiDoc(out io.Writer, rows [][]string, fields []Field) {
+	var b strings.Builder
+	cols := make([]string, len(fields))
+	for i, field := range fields {
+		switch {
+		case i == len(fields)-1:
+			cols[i] = "<4l"
+		case field.align == text.AlignRight:
+			cols[i] = ">1"
+		default:
+			cols[i] = "<1l"
+		}
+	}
+	fmt.Fprintf(&b, "[cols=\"%s\",options=\"header\"]\n|===\n", strings.Join(cols, ","))
+	escape := func(cell string) string { return strings.ReplaceAll(cell, "|", `\|`) }
+	for i, field := range fields {
+		if i > 0 {
+			b.WriteString(" ")
+		}
+		b.WriteString("|" + escape(field.header))
+	}
+	b.WriteString("\n")
+	for _, row := range rows {
+		b.WriteString("\n")
+		for _, cell := range row {
+			b.WriteString("|" + escape(cell) + "\n")
+		}
+	}
+	b.WriteString("|===\n")
+	io.WriteString(out, b.String())
+}
+
+// render comma separated values (RFC 4180), with raw values in KiB
+func renderCSV(out io.Writer, processes []Process, fields []Field, options RenderOptions) {
+	w := csv.NewWriter(out)
+
+	if !options.omitHeader {
+		header := make([]string, len(fields))
+		for i, field := range fields {
+			header[i] = field.name
+		}
+		w.Write(header)
+	}
+	for _, process := range processes {
+		record := make([]string, len(fields))
+		for i, field := range fields {
+			if value := field.value(process); value != nil {
+				record[i] = fmt.Sprint(value)
+			}
+		}
+		w.Write(record)
+	}
+
+	w.Flush()
+}
+
+// render a JSON array with an object per process,
+// with raw values in KiB and fields in output order
+func renderJSON(out io.Writer, processes []Process, fields []Field, options RenderOptions) {
+	var b strings.Builder
+	b.WriteString("[")
+	for i, process := range processes {
+		if i > 0 {
+			b.WriteString(",")
+		}
+		b.WriteString("\n  ")
+		writeJSONObject(&b, process, fields, options)
+	}
+	b.WriteString("\n]\n")
+	io.WriteString(out, b.String())
+}
+
+// render a JSON object per process and line, see renderJSON
+func renderJSONLines(out io.Writer, processes []Process, fields []Field, options RenderOptions) {
+	var b strings.Builder
+	for _, process := range processes {
+		writeJSONObject(&b, process, fields, options)
+		b.WriteString("\n")
+	}
+	io.WriteString(out, b.String())
+}
+
+func writeJSONObject(b *strings.Builder, process Process, fields []Field, options RenderOptions) {
+	b.WriteString("{")
+	for j, field := range fields {
+		if j > 0 {
+			b.WriteString(", ")
+		}
+		writeJSONMember(b, field.name, field.value(process))
+	}
+	if process.incomplete {
+		b.WriteString(", ")
+		writeJSONMember(b, "incomplete", true)
+	}
+	if options.threads {
+		tasks := make([]map[string]any, len(process.tasks))
+		for k, task := range process.tasks {
+			tasks[k] = map[string]any{"tid": task.tid, "name": task.name}
+		}
+		b.WriteString(", ")
+		writeJSONMember(b, "tasks", tasks)
+	}
+	b.WriteString("}")
+}
+
+func writeJSONMember(b *strings.Builder, name string, value any) {
+	b.WriteString(jsonString(name))
+	b.WriteString(": ")
+	b.WriteString(jsonString(value))
+}
+
+// encodes value as JSON, leaving <, > and & in command lines alone
+func jsonString(value any) string {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(value); err != nil {
+		return "null"
+	}
+	return strings.TrimSuffix(buf.String(), "\n")
+}
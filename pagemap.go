@@ -0,0 +1,251 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+)
+
+// see Documentation/admin-guide/mm/pagemap.rst in the kernel sources
+const (
+	pagemapEntrySize = 8
+	pagemapPresent   = 1 << 63
+	pagemapPFNMask   = 1<<55 - 1
+
+	kpfDirty = 1 << 4
+	kpfKSM   = 1 << 21
+
+	// pagemap entries read at once
+	pagemapChunk = 64 * 1024
+	// PFNs closer than this are read from kpagecount/kpageflags in one go
+	kpageGap = 64
+)
+
+var pageSizeKiB = os.Getpagesize() / 1024
+
+// the resident pages of a process: number of times each page frame
+// is mapped into its address space
+type PageFrames map[uint64]int
+
+func readMaps(pid int) ([]Mapping, error) {
+	contents, err := os.ReadFile(fmt.Sprintf("%s/%d/maps", procDir, pid))
+	if err != nil {
+		return nil, err
+	}
+	var mappings []Mapping
+	for _, line := range strings.Split(string(contents), "\n") {
+		if mapping, err := parseMappingHeader(line); err == nil {
+			mappings = append(mappings, mapping)
+		}
+	}
+	return mappings, nil
+}
+
+// walks /proc/PID/pagemap over all mappings of pid and returns
+// the page frames resident in RAM; requires CAP_SYS_ADMIN, otherwise
+// the kernel reports all PFNs as zero
+func readPageFrames(pid int) (PageFrames, error) {
+	mappings, err := readMaps(pid)
+	if err != nil {
+		return nil, err
+	}
+	pagemap, err := os.Open(fmt.Sprintf("%s/%d/pagemap", procDir, pid))
+	if err != nil {
+		return nil, err
+	}
+	defer pagemap.Close()
+
+	pageSize := uint64(os.Getpagesize())
+	frames := PageFrames{}
+	buf := make([]byte, pagemapChunk*pagemapEntrySize)
+	for _, mapping := range mappings {
+		// inaccessible reservations can be huge and have no pages,
+		// and [vsyscall] is not backed by the page tables of the process
+		if mapping.perms[:3] == "---" || mapping.path == "[vsyscall]" {
+			continue
+		}
+		for page := mapping.start / pageSize; page < mapping.end/pageSize; page += pagemapChunk {
+			n := min(mapping.end/pageSize-page, pagemapChunk)
+			read, err := pagemap.ReadAt(buf[:n*pagemapEntrySize], int64(page*pagemapEntrySize))
+			if err != nil && !errors.Is(err, io.EOF) {
+				return nil, err
+			}
+			for i := 0; i+pagemapEntrySize <= read; i += pagemapEntrySize {
+				entry := binary.LittleEndian.Uint64(buf[i:])
+				if entry&pagemapPresent == 0 {
+					continue
+				}
+				pfn := entry & pagemapPFNMask
+				if pfn == 0 {
+					return nil, errors.New("page frame numbers are hidden, run as root")
+				}
+				frames[pfn]++
+			}
+		}
+	}
+	return frames, nil
+}
+
+// reads /proc/kpagecount and /proc/kpageflags, shared by all collectors
+type KPages struct {
+	counts *os.File
+	flags  *os.File
+}
+
+func openKPages() (*KPages, error) {
+	counts, err := os.Open(procDir + "/kpagecount")
+	if err != nil {
+		return nil, err
+	}
+	flags, err := os.Open(procDir + "/kpageflags")
+	if err != nil {
+		counts.Close()
+		return nil, err
+	}
+	return &KPages{counts, flags}, nil
+}
+
+func (k *KPages) Close() {
+	k.counts.Close()
+	k.flags.Close()
+}
+
+// per page frame information from kpagecount and kpageflags
+type KPage struct {
+	mapcount uint64 // number of times the page is mapped, by all processes
+	flags    uint64
+}
+
+// looks up the given page frames, reading runs of nearby PFNs at once
+func (k *KPages) lookup(pfns []uint64) (map[uint64]KPage, error) {
+	slices.Sort(pfns)
+	pages := make(map[uint64]KPage, len(pfns))
+	for i := 0; i < len(pfns); {
+		// extend the run while the next PFN is close
+		j := i + 1
+		for j < len(pfns) && pfns[j]-pfns[j-1] <= kpageGap {
+			j++
+		}
+		first, last := pfns[i], pfns[j-1]
+		counts, err := readKPageRange(k.counts, first, last)
+		if err != nil {
+			return nil, err
+		}
+		flags, err := readKPageRange(k.flags, first, last)
+		if err != nil {
+			return nil, err
+		}
+		for _, pfn := range pfns[i:j] {
+			pages[pfn] = KPage{counts[pfn-first], flags[pfn-first]}
+		}
+		i = j
+	}
+	return pages, nil
+}
+
+func readKPageRange(file *os.File, first, last uint64) ([]uint64, error) {
+	buf := make([]byte, (last-first+1)*8)
+	if _, err := file.ReadAt(buf, int64(first*8)); err != nil {
+		return nil, err
+	}
+	values := make([]uint64, last-first+1)
+	for i := range values {
+		values[i] = binary.LittleEndian.Uint64(buf[i*8:])
+	}
+	return values, nil
+}
+
+// exact resident memory of a process, in pages
+type PageAccounting struct {
+	rss          uint64
+	pss          float64
+	privateClean uint64
+	privateDirty uint64
+	sharedClean  uint64
+	sharedDirty  uint64
+	ksm          uint64
+}
+
+// counts pages of a process by how many times they are mapped in total;
+// a page mapped by nobody else is unique to the process, even if the
+// process maps it more than once
+func (k *KPages) account(frames PageFrames) (PageAccounting, error) {
+	pfns := make([]uint64, 0, len(frames))
+	for pfn := range frames {
+		pfns = append(pfns, pfn)
+	}
+	pages, err := k.lookup(pfns)
+	if err != nil {
+		return PageAccounting{}, err
+	}
+
+	a := PageAccounting{}
+	for pfn, local := range frames {
+		page := pages[pfn]
+		mapcount := max(page.mapcount, uint64(local))
+		dirty := page.flags&kpfDirty != 0
+		a.rss += uint64(local)
+		a.pss += float64(local) / float64(mapcount)
+		if page.flags&kpfKSM != 0 {
+			a.ksm++
+		}
+		switch {
+		case mapcount <= uint64(local) && dirty:
+			a.privateDirty++
+		case mapcount <= uint64(local):
+			a.privateClean++
+		case dirty:
+			a.sharedDirty++
+		default:
+			a.sharedClean++
+		}
+	}
+	return a, nil
+}
+
+// replaces the counters in stats that the kernel derives from the
+// mapcount of pages in one address space with exact values, in KiB
+func (a PageAccounting) apply(stats map[string]int) map[string]int {
+	exact := make(map[string]int, len(stats))
+	for k, v := range stats {
+		exact[k] = v
+	}
+	exact[StatRSS] = int(a.rss) * pageSizeKiB
+	exact[StatPSS] = int(a.pss * float64(pageSizeKiB))
+	exact[StatPrivateClean] = int(a.privateClean) * pageSizeKiB
+	exact[StatPrivateDirty] = int(a.privateDirty) * pageSizeKiB
+	exact[StatSharedClean] = int(a.sharedClean) * pageSizeKiB
+	exact[StatSharedDirty] = int(a.sharedDirty) * pageSizeKiB
+	exact[StatKSM] = int(a.ksm) * pageSizeKiB
+	return exact
+}
+
+// pages mapped only by processes of the given set, i.e. memory that would be
+// freed if all of them exited; in pages
+func (k *KPages) setUnique(frames []PageFrames) (uint64, error) {
+	total := PageFrames{}
+	for _, f := range frames {
+		for pfn, n := range f {
+			total[pfn] += n
+		}
+	}
+	pfns := make([]uint64, 0, len(total))
+	for pfn := range total {
+		pfns = append(pfns, pfn)
+	}
+	pages, err := k.lookup(pfns)
+	if err != nil {
+		return 0, err
+	}
+	unique := uint64(0)
+	for pfn, n := range total {
+		if pages[pfn].mapcount <= uint64(n) {
+			unique++
+		}
+	}
+	return unique, nil
+}
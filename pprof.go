@@ -0,0 +1,264 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// memory of a process or one of its mappings, with the hierarchy it belongs
+// to: cgroup, unit, user, command name, mapping; sizes in KiB
+type MemoryStack struct {
+	frames  []string // outermost first
+	pid     int
+	command string
+	pss     int
+	uss     int
+	rss     int
+	swap    int
+}
+
+// a stack per mapping of each process, or per process if its mappings
+// were not read
+func memoryStacks(processes []Process) []MemoryStack {
+	var stacks []MemoryStack
+	for _, process := range processes {
+		if process.incomplete {
+			continue
+		}
+		cgroup := process.oom.cgroup
+		if cgroup == "" {
+			cgroup = "unknown"
+		}
+		name := process.stat.comm
+		if name == "" {
+			name = process.Command()
+		}
+		frames := []string{cgroup, cgroupUnit(process.oom.cgroup), process.User(), name}
+		if len(process.mappings) == 0 {
+			stacks = append(stacks, MemoryStack{frames, process.pid, process.Command(),
+				process.PSS(), process.USS(), process.RSS(), process.rollup.stats[StatSwap]})
+			continue
+		}
+		for _, m := range process.mappings {
+			if m.RSS() == 0 && m.stats[StatSwap] == 0 {
+				continue
+			}
+			stacks = append(stacks, MemoryStack{append(slices.Clip(frames), m.label()), process.pid, process.Command(),
+				m.PSS(), m.stats[StatPrivateClean] + m.stats[StatPrivateDirty], m.RSS(), m.stats[StatSwap]})
+		}
+	}
+	return stacks
+}
+
+// render stacks in the folded format of flamegraph.pl, a line per stack with
+// frames separated by semicolons and the PSS in KiB, identical stacks merged
+func renderFolded(out io.Writer, processes []Process) {
+	pss := map[string]int{}
+	var order []string
+	for _, stack := range memoryStacks(processes) {
+		frames := make([]string, len(stack.frames))
+		for i, frame := range stack.frames {
+			frames[i] = strings.NewReplacer(";", ":", "\n", " ").Replace(frame)
+		}
+		folded := strings.Join(frames, ";")
+		if _, ok := pss[folded]; !ok {
+			order = append(order, folded)
+		}
+		pss[folded] += stack.pss
+	}
+	var b strings.Builder
+	for _, folded := range order {
+		if pss[folded] > 0 {
+			fmt.Fprintf(&b, "%s %d\n", folded, pss[folded])
+		}
+	}
+	io.WriteString(out, b.String())
+}
+
+// encodes protocol buffers, just enough for profile.proto
+type protoBuffer struct {
+	bytes.Buffer
+}
+
+const (
+	wireVarint = 0
+	wireBytes  = 2
+)
+
+func (b *protoBuffer) varint(x uint64) {
+	for x >= 0x80 {
+		b.WriteByte(byte(x) | 0x80)
+		x >>= 7
+	}
+	b.WriteByte(byte(x))
+}
+
+func (b *protoBuffer) key(field int, wireType int) {
+	b.varint(uint64(field)<<3 | uint64(wireType))
+}
+
+// a varint field, left out if zero, which is the default
+func (b *protoBuffer) uint64Field(field int, x uint64) {
+	if x != 0 {
+		b.key(field, wireVarint)
+		b.varint(x)
+	}
+}
+
+func (b *protoBuffer) int64Field(field int, x int64) {
+	b.uint64Field(field, uint64(x))
+}
+
+// a length delimited field, always written, since the string table
+// starts with an empty string
+func (b *protoBuffer) bytesField(field int, data []byte) {
+	b.key(field, wireBytes)
+	b.varint(uint64(len(data)))
+	b.Write(data)
+}
+
+func (b *protoBuffer) packedField(field int, xs []uint64) {
+	var packed protoBuffer
+	for _, x := range xs {
+		packed.varint(x)
+	}
+	b.bytesField(field, packed.Bytes())
+}
+
+// field numbers of profile.proto, see
+// https://github.com/google/pprof/blob/main/proto/profile.proto
+const (
+	profileSampleType        = 1
+	profileSample            = 2
+	profileLocation          = 4
+	profileFunction          = 5
+	profileStringTable       = 6
+	profileTimeNanos         = 9
+	profilePeriodType        = 11
+	profileDefaultSampleType = 14
+
+	valueTypeType = 1
+	valueTypeUnit = 2
+
+	sampleLocationID = 1
+	sampleValue      = 2
+	sampleLabel      = 3
+
+	labelKey = 1
+	labelStr = 2
+	labelNum = 3
+
+	locationID   = 1
+	locationLine = 4
+	lineFunction = 1
+
+	functionID   = 1
+	functionName = 2
+)
+
+// builds a profile.proto message, with a function and location per frame name
+type profileBuilder struct {
+	strings   []string
+	stringIDs map[string]int64
+	locations map[string]uint64
+	profile   protoBuffer
+}
+
+func newProfileBuilder() *profileBuilder {
+	p := &profileBuilder{stringIDs: map[string]int64{}, locations: map[string]uint64{}}
+	p.str("")
+	return p
+}
+
+// index of s in the string table
+func (p *profileBuilder) str(s string) int64 {
+	if id, ok := p.stringIDs[s]; ok {
+		return id
+	}
+	id := int64(len(p.strings))
+	p.strings = append(p.strings, s)
+	p.stringIDs[s] = id
+	return id
+}
+
+// id of the location of a frame, adding it and its function if new
+func (p *profileBuilder) location(frame string) uint64 {
+	if id, ok := p.locations[frame]; ok {
+		return id
+	}
+	id := uint64(len(p.locations) + 1)
+	p.locations[frame] = id
+
+	var function protoBuffer
+	function.uint64Field(functionID, id)
+	function.int64Field(functionName, p.str(frame))
+	p.profile.bytesField(profileFunction, function.Bytes())
+
+	var line protoBuffer
+	line.uint64Field(lineFunction, id)
+	var location protoBuffer
+	location.uint64Field(locationID, id)
+	location.bytesField(locationLine, line.Bytes())
+	p.profile.bytesField(profileLocation, location.Bytes())
+	return id
+}
+
+func (p *profileBuilder) valueType(field int, typ, unit string) {
+	var valueType protoBuffer
+	valueType.int64Field(valueTypeType, p.str(typ))
+	valueType.int64Field(valueTypeUnit, p.str(unit))
+	p.profile.bytesField(field, valueType.Bytes())
+}
+
+func (p *profileBuilder) label(sample *protoBuffer, key string, value string, num int64) {
+	var label protoBuffer
+	label.int64Field(labelKey, p.str(key))
+	if value != "" {
+		label.int64Field(labelStr, p.str(value))
+	}
+	label.int64Field(labelNum, num)
+	sample.bytesField(sampleLabel, label.Bytes())
+}
+
+// render stacks as a gzip compressed profile.proto for pprof, with a sample
+// per stack, values in bytes, and pid and command line as labels
+func renderPprof(out io.Writer, processes []Process) {
+	p := newProfileBuilder()
+	for _, typ := range []string{"pss", "uss", "rss", "swap"} {
+		p.valueType(profileSampleType, typ, "bytes")
+	}
+	p.valueType(profilePeriodType, "memory", "bytes")
+	p.profile.int64Field(profileDefaultSampleType, p.str("pss"))
+	p.profile.int64Field(profileTimeNanos, time.Now().UnixNano())
+
+	for _, stack := range memoryStacks(processes) {
+		var sample protoBuffer
+		// leaf first
+		ids := make([]uint64, len(stack.frames))
+		for i, frame := range stack.frames {
+			ids[len(ids)-1-i] = p.location(frame)
+		}
+		sample.packedField(sampleLocationID, ids)
+		sample.packedField(sampleValue, []uint64{
+			uint64(stack.pss) * 1024, uint64(stack.uss) * 1024, uint64(stack.rss) * 1024, uint64(stack.swap) * 1024})
+		p.label(&sample, "pid", "", int64(stack.pid))
+		p.label(&sample, "command", stack.command, 0)
+		p.profile.bytesField(profileSample, sample.Bytes())
+	}
+	// the string table comes last, once all strings are known
+	for _, s := range p.strings {
+		p.profile.bytesField(profileStringTable, []byte(s))
+	}
+
+	w := gzip.NewWriter(out)
+	w.Write(p.profile.Bytes())
+	if err := w.Close(); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+	}
+}
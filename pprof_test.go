@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/google/pprof/profile"
+)
+
+func testStackProcesses() []Process {
+	postgres := Process{
+		pid:     4242,
+		stat:    ProcStat{pid: 4242, comm: "postgres", state: "S"},
+		owner:   PidOwner{pid: 4242, username: "postgres"},
+		cmdline: "postgres: checkpointer",
+		oom:     OOMInfo{cgroup: "/system.slice/postgresql.service"},
+		rollup:  SmemRollup{pid: 4242, stats: map[string]int{StatPSS: 3000, StatRSS: 5000}},
+		mappings: []Mapping{
+			testMapping(0x1000, 0x2000, "[heap]", 1000, 1000, 8),
+			testMapping(0x3000, 0x4000, "/usr/lib/postgresql/bin/postgres", 2000, 0, 0),
+			// neither resident nor swapped, left out
+			testMapping(0x5000, 0x6000, "/usr/lib/locale/C.utf8", 0, 0, 0),
+			testMapping(0x7000, 0x8000, "", 2000, 2000, 0),
+		},
+	}
+	// PSS of mappings is that of RSS here, as nothing is shared
+	for _, m := range postgres.mappings {
+		m.stats[StatPSS] = m.stats[StatRSS]
+	}
+	// mappings not read: a single stack for the process, with a ; in its
+	// name that would split the folded stack
+	shell := Process{
+		pid:     100,
+		stat:    ProcStat{pid: 100, comm: "a;b", state: "S"},
+		owner:   PidOwner{pid: 100, username: "root"},
+		cmdline: "/bin/sh -c a;b",
+		rollup:  SmemRollup{pid: 100, stats: map[string]int{StatPSS: 500, StatRSS: 700, StatPrivateDirty: 300, StatSwap: 4}},
+	}
+	incomplete := Process{pid: 7, stat: ProcStat{pid: 7, comm: "slow"}, incomplete: true}
+	return []Process{postgres, shell, incomplete}
+}
+
+func TestRenderFolded(t *testing.T) {
+	var b strings.Builder
+	renderFolded(&b, testStackProcesses())
+	want := `/system.slice/postgresql.service;postgresql.service;postgres;postgres;[heap] 1000
+/system.slice/postgresql.service;postgresql.service;postgres;postgres;/usr/lib/postgresql/bin/postgres 2000
+/system.slice/postgresql.service;postgresql.service;postgres;postgres;[anon] 2000
+unknown;unknown;root;a:b 500
+`
+	if b.String() != want {
+		t.Errorf("renderFolded =\n%s\nwant\n%s", b.String(), want)
+	}
+}
+
+func TestRenderFoldedMerges(t *testing.T) {
+	// identical stacks, e.g. anonymous mappings of one process, are merged
+	processes := testStackProcesses()[:1]
+	processes[0].mappings = append(processes[0].mappings, testMapping(0x9000, 0xa000, "", 500, 500, 0))
+	processes[0].mappings[4].stats[StatPSS] = 500
+	var b strings.Builder
+	renderFolded(&b, processes)
+	if !strings.Contains(b.String(), ";[anon] 2500\n") || strings.Count(b.String(), "[anon]") != 1 {
+		t.Errorf("renderFolded =\n%s\nwant anonymous mappings merged into 2500", b.String())
+	}
+}
+
+func TestRenderPprof(t *testing.T) {
+	var b bytes.Buffer
+	renderPprof(&b, testStackProcesses())
+	p, err := profile.Parse(&b)
+	if err != nil {
+		t.Fatalf("profile.Parse: %v", err)
+	}
+	if err := p.CheckValid(); err != nil {
+		t.Fatalf("invalid profile: %v", err)
+	}
+
+	var types []string
+	for _, st := range p.SampleType {
+		types = append(types, st.Type+"/"+st.Unit)
+	}
+	if !slices.Equal(types, []string{"pss/bytes", "uss/bytes", "rss/bytes", "swap/bytes"}) {
+		t.Errorf("sample types = %v", types)
+	}
+	if p.DefaultSampleType != "pss" || p.PeriodType == nil || p.PeriodType.Type != "memory" || p.TimeNanos == 0 {
+		t.Errorf("default %q, period type %+v, time %d", p.DefaultSampleType, p.PeriodType, p.TimeNanos)
+	}
+
+	type sample struct {
+		stack   string // leaf last, like the folded format
+		values  []int64
+		pid     int64
+		command string
+	}
+	var samples []sample
+	for _, s := range p.Sample {
+		var frames []string
+		for _, location := range s.Location {
+			if len(location.Line) != 1 {
+				t.Fatalf("location %d has %d lines, want 1", location.ID, len(location.Line))
+			}
+			frames = append(frames, location.Line[0].Function.Name)
+		}
+		slices.Reverse(frames)
+		samples = append(samples, sample{strings.Join(frames, ";"), s.Value, s.NumLabel["pid"][0], s.Label["command"][0]})
+	}
+	unit := "/system.slice/postgresql.service;postgresql.service;postgres;postgres;"
+	want := []sample{
+		{unit + "[heap]", []int64{1000 << 10, 1000 << 10, 1000 << 10, 8 << 10}, 4242, "postgres: checkpointer"},
+		{unit + "/usr/lib/postgresql/bin/postgres", []int64{2000 << 10, 0, 2000 << 10, 0}, 4242, "postgres: checkpointer"},
+		{unit + "[anon]", []int64{2000 << 10, 2000 << 10, 2000 << 10, 0}, 4242, "postgres: checkpointer"},
+		{"unknown;unknown;root;a;b", []int64{500 << 10, 300 << 10, 700 << 10, 4 << 10}, 100, "/bin/sh -c a;b"},
+	}
+	if len(samples) != len(want) {
+		t.Fatalf("%d samples, want %d: %+v", len(samples), len(want), samples)
+	}
+	for i := range samples {
+		got, w := samples[i], want[i]
+		if got.stack != w.stack || !slices.Equal(got.values, w.values) || got.pid != w.pid || got.command != w.command {
+			t.Errorf("sample %d = %+v, want %+v", i, got, w)
+		}
+	}
+	// frames shared by stacks are one location and function
+	if len(p.Location) != 9 || len(p.Function) != 9 {
+		t.Errorf("%d locations and %d functions, want 9", len(p.Location), len(p.Function))
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"os"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/jedib0t/go-pretty/v6/text"
+)
+
+// a line of a pressure stall information file: share of time in percent
+// that tasks were stalled on memory, averaged over 10, 60 and 300 seconds
+type PressureLine struct {
+	avg10  float64
+	avg60  float64
+	avg300 float64
+}
+
+// memory pressure, see Documentation/accounting/psi.rst in the kernel sources;
+// some: at least one task stalled, full: all non-idle tasks stalled at once
+type Pressure struct {
+	some PressureLine
+	full PressureLine
+}
+
+func (l PressureLine) String() string {
+	return fmt.Sprintf("%.2f %.2f %.2f", l.avg10, l.avg60, l.avg300)
+}
+
+// one line summary, e.g. for the header of watch
+func (p Pressure) String() string {
+	return fmt.Sprintf("some %s, full %s", p.some, p.full)
+}
+
+func readPressure(path string) (Pressure, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return Pressure{}, err
+	}
+	return parsePressure(string(contents)), nil
+}
+
+// parses lines such as
+// some avg10=0.00 avg60=0.00 avg300=0.00 total=0
+func parsePressure(contents string) Pressure {
+	pressure := Pressure{}
+	for _, line := range strings.Split(contents, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		values := PressureLine{}
+		for _, field := range fields[1:] {
+			key, value, _ := strings.Cut(field, "=")
+			v, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			switch key {
+			case "avg10":
+				values.avg10 = v
+			case "avg60":
+				values.avg60 = v
+			case "avg300":
+				values.avg300 = v
+			}
+		}
+		switch fields[0] {
+		case "some":
+			pressure.some = values
+		case "full":
+			pressure.full = values
+		}
+	}
+	return pressure
+}
+
+func systemPressure() (Pressure, error) {
+	return readPressure(procDir + "/pressure/memory")
+}
+
+func cgroupPressure(cgroup string) (Pressure, error) {
+	if cgroup2Mount() == "" {
+		return Pressure{}, fmt.Errorf("no cgroup v2 hierarchy")
+	}
+	return readPressure(path.Join(cgroup2Mount(), cgroup, "memory.pressure"))
+}
+
+// total PSS of the processes in each cgroup
+type CgroupPSS struct {
+	cgroup    string
+	processes int
+	pss       int
+}
+
+// sums PSS by cgroup, largest first
+func pssByCgroup(processes []Process) []CgroupPSS {
+	sums := map[string]*CgroupPSS{}
+	for _, process := range processes {
+		// the processes counted by sumProcesses
+		if process.stat.isKernelThread() || process.stat.isZombie() ||
+			process.incomplete || len(process.rollup.stats) == 0 {
+			continue
+		}
+		cgroup := process.oom.cgroup
+		if cgroup == "" {
+			continue
+		}
+		sum, ok := sums[cgroup]
+		if !ok {
+			sum = &CgroupPSS{cgroup: cgroup}
+			sums[cgroup] = sum
+		}
+		sum.processes++
+		sum.pss += process.PSS()
+	}
+	result := make([]CgroupPSS, 0, len(sums))
+	for _, sum := range sums {
+		result = append(result, *sum)
+	}
+	slices.SortFunc(result, func(a, b CgroupPSS) int {
+		return cmp.Or(cmp.Compare(b.pss, a.pss), cmp.Compare(a.cgroup, b.cgroup))
+	})
+	return result
+}
+
+// renders system memory pressure, and the pressure of the cgroups
+// with the largest PSS, so that heavy memory users can be tied to stalls
+func renderPressure(processes []Process, limit int, humanReadable bool) {
+	t := table.NewWriter()
+
+	t.SetOutputMirror(os.Stdout)
+	t.SuppressTrailingSpaces()
+	t.SetColumnConfigs([]table.ColumnConfig{
+		{Number: 1, Align: text.AlignLeft, AlignHeader: text.AlignLeft},
+		{Number: 2, Align: text.AlignRight, AlignHeader: text.AlignRight},
+		{Number: 3, Align: text.AlignRight, AlignHeader: text.AlignRight},
+		{Number: 4, Align: text.AlignRight, AlignHeader: text.AlignRight},
+		{Number: 5, Align: text.AlignRight, AlignHeader: text.AlignRight},
+		{Number: 6, Align: text.AlignRight, AlignHeader: text.AlignRight},
+		{Number: 7, Align: text.AlignRight, AlignHeader: text.AlignRight},
+		{Number: 8, Align: text.AlignRight, AlignHeader: text.AlignRight},
+		{Number: 9, Align: text.AlignRight, AlignHeader: text.AlignRight},
+	})
+	t.Style().Options.DrawBorder = false
+	t.Style().Options.SeparateHeader = false
+	t.Style().Options.SeparateColumns = false
+	t.Style().Options.SeparateRows = false
+
+	t.AppendHeader(table.Row{"Memory pressure", "Some10", "Some60", "Some300", "Full10", "Full60", "Full300", "Procs", "PSS"})
+	row := func(name string, p Pressure, rest ...any) table.Row {
+		return append(table.Row{name,
+			fmt.Sprintf("%.2f", p.some.avg10), fmt.Sprintf("%.2f", p.some.avg60), fmt.Sprintf("%.2f", p.some.avg300),
+			fmt.Sprintf("%.2f", p.full.avg10), fmt.Sprintf("%.2f", p.full.avg60), fmt.Sprintf("%.2f", p.full.avg300)},
+			rest...)
+	}
+
+	if pressure, err := systemPressure(); err == nil {
+		t.AppendRow(row("system", pressure, "", ""))
+	} else {
+		fmt.Fprintf(os.Stderr, "warning: no system memory pressure: %v\n", err)
+	}
+	for i, sum := range pssByCgroup(processes) {
+		if i == limit {
+			break
+		}
+		if pressure, err := cgroupPressure(sum.cgroup); err == nil {
+			t.AppendRow(row(sum.cgroup, pressure, sum.processes, kiloBytesToString(sum.pss, humanReadable)))
+		}
+	}
+
+	t.Render()
+}
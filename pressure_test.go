@@ -0,0 +1,78 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParsePressure(t *testing.T) {
+	tests := []struct {
+		contents string
+		want     Pressure
+	}{
+		{
+			"some avg10=1.53 avg60=0.87 avg300=0.21 total=4410423\nfull avg10=0.50 avg60=0.25 avg300=0.05 total=1293374\n",
+			Pressure{PressureLine{1.53, 0.87, 0.21}, PressureLine{0.50, 0.25, 0.05}},
+		},
+		// a missing full line leaves it zero
+		{
+			"some avg10=0.10 avg60=0.20 avg300=0.30 total=5120\n",
+			Pressure{some: PressureLine{0.10, 0.20, 0.30}},
+		},
+		// unknown fields and values that are not numbers are skipped
+		{
+			"some avg10=2.00 avg42=9.00 avg60=x avg300 total=1\nsome-other avg10=7.00\n",
+			Pressure{some: PressureLine{avg10: 2}},
+		},
+		{"", Pressure{}},
+	}
+	for _, test := range tests {
+		if got := parsePressure(test.contents); got != test.want {
+			t.Errorf("parsePressure(%q) = %+v, want %+v", test.contents, got, test.want)
+		}
+	}
+
+	pressure := parsePressure(tests[0].contents)
+	if s := pressure.String(); s != "some 1.53 0.87 0.21, full 0.50 0.25 0.05" {
+		t.Errorf("Pressure.String() = %q", s)
+	}
+}
+
+func TestPssByCgroup(t *testing.T) {
+	process := func(pid int, cgroup string, pss int) Process {
+		return Process{
+			pid:    pid,
+			stat:   ProcStat{pid: pid, state: "S"},
+			rollup: SmemRollup{pid: pid, stats: map[string]int{StatPSS: pss}},
+			oom:    OOMInfo{cgroup: cgroup},
+		}
+	}
+	kernelThread := process(2, "/", 0)
+	kernelThread.stat.flags = pfKthread
+	kernelThread.rollup.stats = nil
+	zombie := process(3, "/user.slice", 0)
+	zombie.stat.state = "Z"
+	incomplete := process(4, "/system.slice/db.service", 0)
+	incomplete.incomplete = true
+
+	processes := []Process{
+		process(10, "/system.slice/db.service", 4000),
+		process(11, "/system.slice/db.service", 2000),
+		process(12, "/user.slice", 1000),
+		process(13, "/system.slice/web.service", 6000),
+		// cgroups with the same PSS are in order of name
+		process(14, "/system.slice/cron.service", 1000),
+		// without a cgroup, e.g. on cgroup v1
+		process(15, "", 9000),
+		kernelThread, zombie, incomplete,
+	}
+	want := []CgroupPSS{
+		{"/system.slice/db.service", 2, 6000},
+		{"/system.slice/web.service", 1, 6000},
+		{"/system.slice/cron.service", 1, 1000},
+		{"/user.slice", 1, 1000},
+	}
+	if got := pssByCgroup(processes); !slices.Equal(got, want) {
+		t.Errorf("pssByCgroup = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/signal"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/dustin/go-humanize"
+)
+
+// fields recorded for each process, besides those always output
+var recordColumns = []Column{
+	// clock ticks after boot, tells apart processes with the same PID
+	{name: "start", header: "Start", value: func(p Process) int { return int(p.stat.startTime) }},
+	rollupColumn("Swap"),
+	rollupColumn("Anonymous"),
+	cgroupColumn,
+}
+
+// recording formats, a subset of the output formats
+var recordFormats = []string{OutputJSON, OutputCSV}
+
+// appends samples to a file, rotating it when it grows too large or old
+type Recorder struct {
+	path    string
+	format  string
+	maxSize int64         // rotate when the file is larger, 0 for no limit
+	maxAge  time.Duration // rotate when the file is older, 0 for no limit
+	file    *os.File
+	size    int64
+	opened  time.Time
+}
+
+func (r *Recorder) open() error {
+	file, err := os.OpenFile(r.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	r.file = file
+	r.size = info.Size()
+	r.opened = time.Now()
+	return nil
+}
+
+// reopens the file, after it was moved away by logrotate or similar
+func (r *Recorder) reopen() error {
+	r.file.Close()
+	return r.open()
+}
+
+// renames the file to one with the current time appended, and starts a new one;
+// a counter is appended as well if a file of that name exists
+func (r *Recorder) rotate(now time.Time) error {
+	r.file.Close()
+	base := r.path + "." + now.Format("20060102T150405.000")
+	rotated := base
+	for i := 1; ; i++ {
+		if _, err := os.Lstat(rotated); errors.Is(err, fs.ErrNotExist) {
+			break
+		}
+		rotated = base + "." + strconv.Itoa(i)
+	}
+	if err := os.Rename(r.path, rotated); err != nil {
+		return err
+	}
+	return r.open()
+}
+
+func (r *Recorder) Close() error {
+	return r.file.Close()
+}
+
+// appends a sample of processes taken at the given time
+func (r *Recorder) write(processes []Process, sampled time.Time) error {
+	if r.size > 0 && (r.maxSize > 0 && r.size >= r.maxSize || r.maxAge > 0 && sampled.Sub(r.opened) >= r.maxAge) {
+		if err := r.rotate(sampled); err != nil {
+			return err
+		}
+	}
+
+	// a CSV header starts each file
+	options := RenderOptions{columns: recordColumns, format: r.format, time: sampled, omitHeader: r.size > 0}
+	fields := outputFields(options)
+	var b strings.Builder
+	if r.format == OutputCSV {
+		renderCSV(&b, processes, fields, options)
+	} else {
+		renderJSONLines(&b, processes, fields, options)
+	}
+	n, err := r.file.WriteString(b.String())
+	r.size += int64(n)
+	return err
+}
+
+const flagRecordOutputDescription = "file to append samples to"
+const flagRecordEncodingDescription = "encoding of samples: json (lines) or csv"
+const flagMaxSizeDescription = "rotate the file when larger than this (e.g. 100MiB)"
+const flagMaxAgeDescription = "rotate the file when older than this (e.g. 24h)"
+
+func printRecordUsage() {
+	fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s record [OPTION]... -o FILE [PID]...\n", os.Args[0])
+	fmt.Fprintf(flag.CommandLine.Output(), `Append a sample of the memory of processes to a file every interval, with the
+time of the sample, swap, anonymous memory and cgroup of each process.
+Rotated files get the time of rotation appended to their name. On SIGHUP,
+the file is reopened.
+Options:
+  --help                %s
+  -o, --output          %s
+  --encoding            %s
+  -j, --jobs            %s
+  -t, --timeout         %s
+  -a, --all-tasks       %s
+  --interval            %s (default 5s)
+  --count               %s
+  --max-size            %s
+  --max-age             %s
+`,
+		flagHelpDescription,
+		flagRecordOutputDescription,
+		flagRecordEncodingDescription,
+		flagJobsDescription,
+		flagTimeoutDescription,
+		flagAllTasksDescription,
+		flagIntervalDescription,
+		flagCountDescription,
+		flagMaxSizeDescription,
+		flagMaxAgeDescription)
+}
+
+func runRecord(args []string) int {
+	flags := flag.NewFlagSet("record", flag.ExitOnError)
+	var help, allTasks bool
+	var path, encoding, maxSize string
+	var jobs, count int
+	var timeout, interval, maxAge time.Duration
+	flags.BoolVar(&help, "help", false, flagHelpDescription)
+	flags.StringVar(&path, "output", "", flagRecordOutputDescription)
+	flags.StringVar(&path, "o", "", flagRecordOutputDescription)
+	flags.StringVar(&encoding, "encoding", OutputJSON, flagRecordEncodingDescription)
+	flags.IntVar(&jobs, "jobs", runtime.NumCPU(), flagJobsDescription)
+	flags.IntVar(&jobs, "j", runtime.NumCPU(), flagJobsDescription)
+	flags.DurationVar(&timeout, "timeout", 0, flagTimeoutDescription)
+	flags.DurationVar(&timeout, "t", 0, flagTimeoutDescription)
+	flags.BoolVar(&allTasks, "all-tasks", false, flagAllTasksDescription)
+	flags.BoolVar(&allTasks, "a", false, flagAllTasksDescription)
+	flags.DurationVar(&interval, "interval", 5*time.Second, flagIntervalDescription)
+	flags.IntVar(&count, "count", 0, flagCountDescription)
+	flags.StringVar(&maxSize, "max-size", "", flagMaxSizeDescription)
+	flags.DurationVar(&maxAge, "max-age", 0, flagMaxAgeDescription)
+	flags.Usage = printRecordUsage
+	flags.Parse(args)
+
+	if help {
+		printRecordUsage()
+		return ExitSuccess
+	}
+	if path == "" {
+		fmt.Fprintf(os.Stderr, "error: record requires an output file\n")
+		printRecordUsage()
+		return ExitInvalidArguments
+	}
+	if !slices.Contains(recordFormats, encoding) {
+		fmt.Fprintf(os.Stderr, "error: unknown encoding: %s\n", encoding)
+		return ExitInvalidArguments
+	}
+	if interval <= 0 || count < 0 || maxAge < 0 {
+		fmt.Fprintf(os.Stderr, "error: interval must be positive, and count and max age not negative\n")
+		return ExitInvalidArguments
+	}
+	recorder := &Recorder{path: path, format: encoding, maxAge: maxAge}
+	if maxSize != "" {
+		size, err := humanize.ParseBytes(maxSize)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: invalid max size: %v\n", err)
+			return ExitInvalidArguments
+		}
+		recorder.maxSize = int64(size)
+	}
+
+	selectedPids, err := parsePidArgs(flags.Args())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return ExitInvalidArguments
+	}
+
+	if err := recorder.open(); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return ExitFailure
+	}
+	defer recorder.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	defer signal.Stop(hangup)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	options := CollectOptions{jobs: jobs, timeout: timeout, allTasks: allTasks, oom: true}
+	for samples := 1; ; samples++ {
+		pids := selectedPids
+		if len(pids) == 0 {
+			pids = allProcesses()
+		}
+		sampled := time.Now()
+		processes := collectProcesses(ctx, pids, options)
+		resetCgroupMemory()
+		// a sample cut short by an interrupt is not recorded
+		if ctx.Err() != nil {
+			break
+		}
+		sortProcesses(processes, "pid", false)
+		if err := recorder.write(processes, sampled); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			return ExitFailure
+		}
+		if samples == count {
+			break
+		}
+
+	wait:
+		for {
+			select {
+			case <-ticker.C:
+				break wait
+			case <-hangup:
+				if err := recorder.reopen(); err != nil {
+					fmt.Fprintf(os.Stderr, "error: %v\n", err)
+					return ExitFailure
+				}
+			case <-ctx.Done():
+				return ExitSuccess
+			}
+		}
+	}
+	return ExitSuccess
+}
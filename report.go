@@ -0,0 +1,607 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/jedib0t/go-pretty/v6/text"
+)
+
+// a process in one sample of a recording, see recordColumns
+type Record struct {
+	Time       time.Time `json:"time"`
+	PID        int       `json:"pid"`
+	Start      uint64    `json:"start"`
+	User       string    `json:"user"`
+	USS        int       `json:"uss"`
+	PSS        int       `json:"pss"`
+	RSS        int       `json:"rss"`
+	Swap       int       `json:"swap"`
+	Anonymous  int       `json:"anonymous"`
+	Cgroup     string    `json:"cgroup"`
+	Command    string    `json:"command"`
+	Incomplete bool      `json:"incomplete"`
+}
+
+// the recorded process as a Process, so that it can be sorted like live ones
+func (r Record) Process() Process {
+	return Process{
+		pid:    r.PID,
+		stat:   ProcStat{pid: r.PID, startTime: r.Start},
+		status: ProcStatus{counters: map[string]int{"vmswap": r.Swap}},
+		rollup: SmemRollup{pid: r.PID, stats: map[string]int{
+			StatPSS:          r.PSS,
+			StatRSS:          r.RSS,
+			StatPrivateClean: r.USS,
+			StatSwap:         r.Swap,
+			"anonymous":      r.Anonymous,
+		}},
+		owner:   PidOwner{pid: r.PID, username: r.User},
+		cmdline: r.Command,
+		oom:     OOMInfo{cgroup: r.Cgroup},
+	}
+}
+
+// reads a recording in either format, JSON lines or CSV with a header
+func readRecording(path string) ([]Record, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	first, err := reader.Peek(1)
+	if errors.Is(err, io.EOF) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if first[0] == '{' {
+		return readJSONRecords(reader)
+	}
+	return readCSVRecords(reader)
+}
+
+// reads the files of a recording, keeping records of the given PIDs,
+// or all if none are given, in order of time
+func readRecordings(paths []string, pids map[int]bool) ([]Record, error) {
+	var records []Record
+	for _, path := range paths {
+		read, err := readRecording(path)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		records = append(records, read...)
+	}
+	if len(records) == 0 {
+		return nil, errors.New("no samples in recording")
+	}
+	if len(pids) > 0 {
+		records = slices.DeleteFunc(records, func(r Record) bool { return !pids[r.PID] })
+		if len(records) == 0 {
+			return nil, errors.New("no samples of the given PIDs in recording")
+		}
+	}
+	slices.SortStableFunc(records, func(a, b Record) int { return a.Time.Compare(b.Time) })
+	return records, nil
+}
+
+func readJSONRecords(r io.Reader) ([]Record, error) {
+	var records []Record
+	decoder := json.NewDecoder(r)
+	for {
+		var record Record
+		err := decoder.Decode(&record)
+		if errors.Is(err, io.EOF) {
+			return records, nil
+		} else if err != nil {
+			return records, err
+		}
+		if !record.Incomplete {
+			records = append(records, record)
+		}
+	}
+}
+
+func readCSVRecords(r io.Reader) ([]Record, error) {
+	var records []Record
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		fields, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return records, nil
+		} else if err != nil {
+			return records, err
+		}
+		values := map[string]string{}
+		for i, name := range header {
+			if i < len(fields) {
+				values[name] = fields[i]
+			}
+		}
+		record, err := parseCSVRecord(values)
+		if err != nil {
+			return records, err
+		}
+		// incomplete processes have empty sizes
+		if values["pss"] != "" {
+			records = append(records, record)
+		}
+	}
+}
+
+func parseCSVRecord(values map[string]string) (Record, error) {
+	sampled, err := time.Parse(time.RFC3339, values["time"])
+	if err != nil {
+		return Record{}, err
+	}
+	record := Record{Time: sampled, User: values["user"], Cgroup: values["cgroup"], Command: values["command"]}
+	record.Start, _ = strconv.ParseUint(values["start"], 10, 64)
+	for name, value := range map[string]*int{
+		"pid":       &record.PID,
+		"uss":       &record.USS,
+		"pss":       &record.PSS,
+		"rss":       &record.RSS,
+		"swap":      &record.Swap,
+		"anonymous": &record.Anonymous,
+	} {
+		*value, _ = strconv.Atoi(values[name])
+	}
+	return record, nil
+}
+
+// a metric reported for each process or group
+type Metric struct {
+	name  string
+	value func(Record) int
+}
+
+var reportMetrics = []Metric{
+	{"PSS", func(r Record) int { return r.PSS }},
+	{"USS", func(r Record) int { return r.USS }},
+	{"RSS", func(r Record) int { return r.RSS }},
+	{"Swap", func(r Record) int { return r.Swap }},
+}
+
+// statistics of a metric over the samples of a process or group
+type MetricStats struct {
+	min, p50, p95, max int
+	peak               time.Time // first sample with the maximum
+	values             []int     // in order of time, for the sparkline
+}
+
+// nearest rank percentile of sorted values
+func percentile(sorted []int, p float64) int {
+	rank := int(math.Ceil(p*float64(len(sorted)))) - 1
+	return sorted[max(rank, 0)]
+}
+
+func metricStats(records []Record, value func(Record) int) MetricStats {
+	stats := MetricStats{values: make([]int, len(records))}
+	for i, record := range records {
+		stats.values[i] = value(record)
+		if i == 0 || stats.values[i] > stats.max {
+			stats.max = stats.values[i]
+			stats.peak = record.Time
+		}
+	}
+	sorted := slices.Sorted(slices.Values(stats.values))
+	stats.min = sorted[0]
+	stats.p50 = percentile(sorted, 0.5)
+	stats.p95 = percentile(sorted, 0.95)
+	return stats
+}
+
+const sparkTicks = "▁▂▃▄▅▆▇█"
+
+// renders values as a line of block characters of at most width, with the
+// maximum of the values falling into each character
+func sparkline(values []int, width int) string {
+	if len(values) == 0 {
+		return ""
+	}
+	buckets := min(width, len(values))
+	maxima := make([]int, buckets)
+	for i := range maxima {
+		maxima[i] = math.MinInt
+	}
+	for i, value := range values {
+		bucket := i * buckets / len(values)
+		maxima[bucket] = max(maxima[bucket], value)
+	}
+	low, high := slices.Min(maxima), slices.Max(maxima)
+
+	ticks := []rune(sparkTicks)
+	var b strings.Builder
+	for _, value := range maxima {
+		tick := 0
+		if high > low {
+			tick = (value - low) * (len(ticks) - 1) / (high - low)
+		}
+		b.WriteRune(ticks[tick])
+	}
+	return b.String()
+}
+
+// the samples of a process, or the sums of the samples of a group of processes
+type ReportRow struct {
+	process  Process // peak of each metric, for sorting
+	name     string  // of the group
+	records  []Record
+	procs    int // processes in the group
+	first    time.Time
+	last     time.Time
+	metrics  []MetricStats
+	recorded bool // seen in the first or the last sample of the recording
+}
+
+func newReportRow(records []Record, recordingStart, recordingEnd time.Time) ReportRow {
+	row := ReportRow{records: records, procs: 1, first: records[0].Time, last: records[len(records)-1].Time}
+	row.recorded = !row.first.After(recordingStart) || !row.last.Before(recordingEnd)
+	peaks := records[len(records)-1]
+	for _, metric := range reportMetrics {
+		stats := metricStats(records, metric.value)
+		row.metrics = append(row.metrics, stats)
+	}
+	peaks.PSS, peaks.USS, peaks.RSS, peaks.Swap = row.metrics[0].max, row.metrics[1].max, row.metrics[2].max, row.metrics[3].max
+	row.process = peaks.Process()
+	return row
+}
+
+// groups records by process, matching on PID and start time
+func processRows(records []Record, start, end time.Time) []ReportRow {
+	byProcess := map[ProcessKey][]Record{}
+	var order []ProcessKey
+	for _, record := range records {
+		key := ProcessKey{record.PID, record.Start}
+		if _, ok := byProcess[key]; !ok {
+			order = append(order, key)
+		}
+		byProcess[key] = append(byProcess[key], record)
+	}
+	rows := make([]ReportRow, 0, len(order))
+	for _, key := range order {
+		rows = append(rows, newReportRow(byProcess[key], start, end))
+	}
+	return rows
+}
+
+// keeps the records of processes whose peaks match the expression, before
+// they are grouped
+func filterRecords(records []Record, where *Expression, fields []Field) ([]Record, error) {
+	rows := processRows(records, records[0].Time, records[len(records)-1].Time)
+	processes := make([]Process, len(rows))
+	for i, row := range rows {
+		processes[i] = row.process
+	}
+	matching, err := filterProcesses(processes, where, fields)
+	if err != nil {
+		return nil, err
+	}
+	keep := map[ProcessKey]bool{}
+	for _, process := range matching {
+		keep[process.Key()] = true
+	}
+	return slices.DeleteFunc(records, func(r Record) bool { return !keep[ProcessKey{r.PID, r.Start}] }), nil
+}
+
+// how records are grouped with --group
+var reportGroups = map[string]func(Record) string{
+	"user":    func(r Record) string { return r.User },
+	"cgroup":  func(r Record) string { return r.Cgroup },
+	"command": func(r Record) string { return r.Command },
+}
+
+// sums records of each group per sample
+func groupRows(records []Record, group string, start, end time.Time) []ReportRow {
+	groupOf := reportGroups[group]
+	type sample struct {
+		group string
+		time  time.Time
+	}
+	sums := map[sample]*Record{}
+	processes := map[string]map[ProcessKey]bool{}
+	var order []sample
+	for _, record := range records {
+		key := sample{groupOf(record), record.Time}
+		sum, ok := sums[key]
+		if !ok {
+			sum = &Record{Time: record.Time, User: record.User, Cgroup: record.Cgroup, Command: record.Command}
+			sums[key] = sum
+			order = append(order, key)
+		}
+		sum.USS += record.USS
+		sum.PSS += record.PSS
+		sum.RSS += record.RSS
+		sum.Swap += record.Swap
+		sum.Anonymous += record.Anonymous
+		if processes[key.group] == nil {
+			processes[key.group] = map[ProcessKey]bool{}
+		}
+		processes[key.group][ProcessKey{record.PID, record.Start}] = true
+	}
+
+	byGroup := map[string][]Record{}
+	var groups []string
+	for _, key := range order {
+		if _, ok := byGroup[key.group]; !ok {
+			groups = append(groups, key.group)
+		}
+		byGroup[key.group] = append(byGroup[key.group], *sums[key])
+	}
+	rows := make([]ReportRow, 0, len(groups))
+	for _, name := range groups {
+		row := newReportRow(byGroup[name], start, end)
+		row.name = name
+		row.procs = len(processes[name])
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// sorts rows like processes in live mode, with the peak of each metric
+func sortReportRows(rows []ReportRow, key string, reverseOrder bool) {
+	compare := processComparator(key, reverseOrder)
+	slices.SortStableFunc(rows, func(a, b ReportRow) int {
+		return compare(a.process, b.process)
+	})
+}
+
+// duration rounded to seconds, or tenths of a second for short recordings
+func durationToString(d time.Duration) string {
+	if d < time.Minute {
+		return d.Round(100 * time.Millisecond).String()
+	}
+	return d.Round(time.Second).String()
+}
+
+func renderReport(rows []ReportRow, group string, isWideOutput bool, humanReadable bool) {
+	t := table.NewWriter()
+
+	t.SetOutputMirror(os.Stdout)
+	t.SuppressTrailingSpaces()
+	t.Style().Options.DrawBorder = false
+	t.Style().Options.SeparateHeader = false
+	t.Style().Options.SeparateColumns = false
+	t.Style().Options.SeparateRows = false
+
+	var header table.Row
+	var configs []table.ColumnConfig
+	if group == "" {
+		header = table.Row{"PID", "User"}
+		configs = []table.ColumnConfig{
+			{Number: 1, Align: text.AlignRight, AlignHeader: text.AlignRight},
+			{Number: 2, Align: text.AlignLeft, AlignHeader: text.AlignLeft},
+		}
+	} else {
+		header = table.Row{strings.ToUpper(group[:1]) + group[1:], "Procs"}
+		configs = []table.ColumnConfig{
+			{Number: 1, Align: text.AlignLeft, AlignHeader: text.AlignLeft},
+			{Number: 2, Align: text.AlignRight, AlignHeader: text.AlignRight},
+		}
+	}
+	header = append(header, "Lifetime", "Metric", "Min", "P50", "P95", "Max", "Peak At", "Trend")
+	for i := 3; i <= 9; i++ {
+		configs = append(configs, table.ColumnConfig{Number: i, Align: text.AlignRight, AlignHeader: text.AlignRight})
+	}
+	configs = append(configs, table.ColumnConfig{Number: 10, Align: text.AlignLeft, AlignHeader: text.AlignLeft})
+	if group == "" {
+		header = append(header, "Command")
+		configs = append(configs, table.ColumnConfig{Number: 11, Align: text.AlignLeft, AlignHeader: text.AlignLeft})
+	}
+	t.SetColumnConfigs(configs)
+	t.AppendHeader(header)
+
+	// show the date of peaks only for recordings spanning several days
+	peakFormat := time.TimeOnly
+	for _, row := range rows {
+		if row.first.YearDay() != rows[0].first.YearDay() || row.last.YearDay() != rows[0].first.YearDay() {
+			peakFormat = time.DateTime
+		}
+	}
+
+	for _, row := range rows {
+		lifetime := durationToString(row.last.Sub(row.first))
+		// the process may have lived longer than recorded
+		if row.recorded {
+			lifetime = ">" + lifetime
+		}
+		for i, metric := range reportMetrics {
+			stats := row.metrics[i]
+			var r table.Row
+			if i > 0 {
+				r = table.Row{"", "", ""}
+			} else if group == "" {
+				r = table.Row{row.process.PID(), row.process.User(), lifetime}
+			} else {
+				r = table.Row{truncateCommand(row.name, 40, isWideOutput), row.procs, lifetime}
+			}
+			r = append(r,
+				metric.name,
+				kiloBytesToString(stats.min, humanReadable),
+				kiloBytesToString(stats.p50, humanReadable),
+				kiloBytesToString(stats.p95, humanReadable),
+				kiloBytesToString(stats.max, humanReadable),
+				stats.peak.Local().Format(peakFormat),
+				sparkline(stats.values, 20))
+			if group == "" {
+				command := ""
+				if i == 0 {
+					command = truncateCommand(row.process.Command(), 40, isWideOutput)
+				}
+				r = append(r, command)
+			}
+			t.AppendRow(r)
+		}
+	}
+
+	t.Render()
+}
+
+const flagGroupDescription = "report groups of processes: user, cgroup or command"
+const flagReportPidsDescription = "comma separated list of PIDs to report"
+const flagHTMLDescription = "write an HTML page with charts and a treemap"
+
+func printReportUsage() {
+	fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s report [OPTION]... FILE... [PID]...\n", os.Args[0])
+	fmt.Fprintf(flag.CommandLine.Output(), `Read recordings of psmaps record, and report the minimum, median, 95th
+percentile and maximum of PSS, USS, RSS and swap of each process over time,
+when the maximum was reached, how long the process was seen, and a sparkline.
+Rotated files of a recording can be given together, and PIDs select the
+processes to report.
+Options:
+  --help                %s
+  -w, --wide            %s
+  -k, --key             %s (sizes sort by maximum)
+  -r, --reverse         %s
+  -h, --human-readable  %s
+  -p, --pids            %s
+  --where               %s
+  --group               %s
+  --html                %s
+`,
+		flagHelpDescription,
+		flagWideDescription,
+		flagSortKeyDescription,
+		flagReverseSortDescription,
+		flagHumanReadableDescription,
+		flagReportPidsDescription,
+		flagWhereDescription,
+		flagGroupDescription,
+		flagHTMLDescription)
+}
+
+func runReport(args []string) int {
+	flags := flag.NewFlagSet("report", flag.ExitOnError)
+	var help, wideOutput, reverseOrder, humanReadable, html bool
+	var sortKey, pidList, where, group string
+	flags.BoolVar(&help, "help", false, flagHelpDescription)
+	flags.BoolVar(&wideOutput, "wide", false, flagWideDescription)
+	flags.BoolVar(&wideOutput, "w", false, flagWideDescription)
+	flags.StringVar(&sortKey, "key", "pid", flagSortKeyDescription)
+	flags.StringVar(&sortKey, "k", "pid", flagSortKeyDescription)
+	flags.BoolVar(&reverseOrder, "reverse", false, flagReverseSortDescription)
+	flags.BoolVar(&reverseOrder, "r", false, flagReverseSortDescription)
+	flags.BoolVar(&humanReadable, "human-readable", false, flagHumanReadableDescription)
+	flags.BoolVar(&humanReadable, "h", false, flagHumanReadableDescription)
+	flags.StringVar(&pidList, "pids", "", flagReportPidsDescription)
+	flags.StringVar(&pidList, "p", "", flagReportPidsDescription)
+	flags.StringVar(&where, "where", "", flagWhereDescription)
+	flags.StringVar(&group, "group", "", flagGroupDescription)
+	flags.BoolVar(&html, "html", false, flagHTMLDescription)
+	flags.Usage = printReportUsage
+	flags.Parse(args)
+
+	if help {
+		printReportUsage()
+		return ExitSuccess
+	}
+	// arguments are recordings, or PIDs unless a file has that name
+	var paths []string
+	pids := map[int]bool{}
+	for _, arg := range flags.Args() {
+		if _, err := os.Stat(arg); err != nil {
+			if pid, err := strconv.Atoi(arg); err == nil && pid > 0 {
+				pids[pid] = true
+				continue
+			}
+		}
+		paths = append(paths, arg)
+	}
+	if len(paths) == 0 {
+		printReportUsage()
+		return ExitInvalidArguments
+	}
+	if !isSortKey(sortKey) {
+		fmt.Fprintf(os.Stderr, "error: unknown sort key: %s\n", sortKey)
+		return ExitInvalidArguments
+	}
+	if _, ok := reportGroups[group]; group != "" && !ok {
+		fmt.Fprintf(os.Stderr, "error: unknown group: %s\n", group)
+		return ExitInvalidArguments
+	}
+	fields := outputFields(RenderOptions{format: OutputTable})
+	var whereExpression *Expression
+	if where != "" {
+		var err error
+		whereExpression, err = parseExpression(where, fields)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: --where: %v\n", err)
+			return ExitInvalidArguments
+		}
+	}
+	if pidList != "" {
+		for _, field := range strings.Split(pidList, ",") {
+			pid, err := strconv.Atoi(field)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error: invalid PID: %s\n", field)
+				return ExitInvalidArguments
+			}
+			pids[pid] = true
+		}
+	}
+
+	records, err := readRecordings(paths, pids)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return ExitFailure
+	}
+	if whereExpression != nil {
+		records, err = filterRecords(records, whereExpression, fields)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: --where: %v\n", err)
+			return ExitInvalidArguments
+		}
+		if len(records) == 0 {
+			fmt.Fprintf(os.Stderr, "error: no recorded process matches --where\n")
+			return ExitFailure
+		}
+	}
+	start, end := records[0].Time, records[len(records)-1].Time
+
+	var rows []ReportRow
+	if group == "" {
+		rows = processRows(records, start, end)
+	} else {
+		rows = groupRows(records, group, start, end)
+	}
+	sortReportRows(rows, sortKey, reverseOrder)
+
+	if html {
+		renderHTML(os.Stdout, reportPage(rows, group, records, humanReadable))
+		return ExitSuccess
+	}
+
+	fmt.Printf("%d samples from %s to %s\n", countSamples(records), start.Local().Format(time.DateTime), end.Local().Format(time.DateTime))
+	renderReport(rows, group, wideOutput, humanReadable)
+	return ExitSuccess
+}
+
+// number of distinct sample times in sorted records
+func countSamples(records []Record) int {
+	samples := 0
+	for i, record := range records {
+		if i == 0 || !record.Time.Equal(records[i-1].Time) {
+			samples++
+		}
+	}
+	return samples
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func testProcess(pid int, user, command string, pss, swap int) Process {
+	return Process{
+		pid:  pid,
+		stat: ProcStat{pid: pid, startTime: uint64(1000 + pid)},
+		rollup: SmemRollup{pid: pid, stats: map[string]int{
+			StatPSS:          pss,
+			StatRSS:          2 * pss,
+			StatPrivateClean: pss / 4,
+			StatPrivateDirty: pss / 4,
+			StatSwap:         swap,
+			"anonymous":      pss / 2,
+		}},
+		owner:   PidOwner{pid: pid, username: user},
+		cmdline: command,
+		oom:     OOMInfo{cgroup: "/system.slice/" + user + ".service"},
+	}
+}
+
+func TestRecordingRoundTrip(t *testing.T) {
+	processes := []Process{
+		testProcess(1, "root", "/sbin/init", 8192, 0),
+		testProcess(4242, "postgres", `postgres: writer "main", idle`, 102400, 512),
+		{pid: 77, stat: ProcStat{pid: 77, startTime: 1077}, owner: PidOwner{pid: 77, username: "root"}, incomplete: true},
+	}
+	first := time.Date(2026, 10, 18, 12, 0, 0, 250*int(time.Millisecond), time.UTC)
+	second := first.Add(10 * time.Second)
+	var want []Record
+	for _, sampled := range []time.Time{first, second} {
+		for _, p := range processes[:2] {
+			want = append(want, Record{
+				Time:      sampled,
+				PID:       p.pid,
+				Start:     p.stat.startTime,
+				User:      p.owner.username,
+				USS:       p.USS(),
+				PSS:       p.PSS(),
+				RSS:       p.RSS(),
+				Swap:      p.Swap(),
+				Anonymous: p.rollup.stats["anonymous"],
+				Cgroup:    p.oom.cgroup,
+				Command:   p.cmdline,
+			})
+		}
+	}
+
+	for _, format := range recordFormats {
+		t.Run(format, func(t *testing.T) {
+			recorder := Recorder{path: filepath.Join(t.TempDir(), "psmaps."+format), format: format}
+			if err := recorder.open(); err != nil {
+				t.Fatal(err)
+			}
+			for _, sampled := range []time.Time{first, second} {
+				if err := recorder.write(processes, sampled); err != nil {
+					t.Fatal(err)
+				}
+			}
+			recorder.Close()
+
+			got, err := readRecording(recorder.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != len(want) {
+				t.Fatalf("read %d records, want %d: %+v", len(got), len(want), got)
+			}
+			for i := range got {
+				if !got[i].Time.Equal(want[i].Time) {
+					t.Errorf("record %d time = %v, want %v", i, got[i].Time, want[i].Time)
+				}
+				got[i].Time = want[i].Time
+				if got[i] != want[i] {
+					t.Errorf("record %d = %+v, want %+v", i, got[i], want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestMetricStatsPercentiles(t *testing.T) {
+	tests := []struct {
+		values        []int
+		min, p50, p95 int
+		max           int
+	}{
+		{[]int{7}, 7, 7, 7, 7},
+		{[]int{3, 1}, 1, 1, 3, 3},
+		{[]int{2, 9, 4}, 2, 4, 9, 9},
+		{[]int{4, 1, 3, 2}, 1, 2, 4, 4},
+		{[]int{5, 5, 1, 5, 5}, 1, 5, 5, 5},
+		// the 95th percentile is below the maximum only from 21 samples
+		{[]int{20, 19, 18, 17, 16, 15, 14, 13, 12, 11, 10, 9, 8, 7, 6, 5, 4, 3, 2, 1, 100}, 1, 11, 20, 100},
+	}
+	start := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	for _, test := range tests {
+		records := make([]Record, len(test.values))
+		for i, value := range test.values {
+			records[i] = Record{Time: start.Add(time.Duration(i) * time.Second), PSS: value}
+		}
+		stats := metricStats(records, func(r Record) int { return r.PSS })
+		if stats.min != test.min || stats.p50 != test.p50 || stats.p95 != test.p95 || stats.max != test.max {
+			t.Errorf("metricStats(%v) = min %d, p50 %d, p95 %d, max %d, want %d, %d, %d, %d",
+				test.values, stats.min, stats.p50, stats.p95, stats.max, test.min, test.p50, test.p95, test.max)
+		}
+		if peak := start.Add(time.Duration(slices.Index(test.values, test.max)) * time.Second); !stats.peak.Equal(peak) {
+			t.Errorf("metricStats(%v) peak = %v, want first maximum at %v", test.values, stats.peak, peak)
+		}
+	}
+}
+
+func TestGroupRows(t *testing.T) {
+	start := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	end := start.Add(time.Minute)
+	record := func(offset time.Duration, pid int, user string, pss int) Record {
+		return Record{Time: start.Add(offset), PID: pid, Start: uint64(pid), User: user, PSS: pss, USS: pss / 2, Swap: 1}
+	}
+	records := []Record{
+		record(0, 1, "root", 100),
+		record(0, 2, "www", 300),
+		record(0, 3, "www", 200),
+		record(30*time.Second, 2, "www", 400),
+		// PID 3 exited, PID 4 started
+		record(time.Minute, 1, "root", 100),
+		record(time.Minute, 2, "www", 100),
+		record(time.Minute, 4, "www", 50),
+	}
+
+	rows := groupRows(records, "user", start, end)
+	if len(rows) != 2 || rows[0].name != "root" || rows[1].name != "www" {
+		t.Fatalf("groups = %+v, want root and www in order of appearance", rows)
+	}
+	root, www := rows[0], rows[1]
+	if root.procs != 1 || www.procs != 3 {
+		t.Errorf("processes = %d, %d, want 1, 3", root.procs, www.procs)
+	}
+	if !slices.Equal(www.metrics[0].values, []int{500, 400, 150}) {
+		t.Errorf("www PSS = %v, want sums per sample 500, 400, 150", www.metrics[0].values)
+	}
+	if !slices.Equal(www.metrics[1].values, []int{250, 200, 75}) {
+		t.Errorf("www USS = %v, want 250, 200, 75", www.metrics[1].values)
+	}
+	if !slices.Equal(www.metrics[3].values, []int{2, 1, 2}) {
+		t.Errorf("www swap = %v, want 2, 1, 2", www.metrics[3].values)
+	}
+	if www.metrics[0].max != 500 || !www.metrics[0].peak.Equal(start) {
+		t.Errorf("www peak PSS = %d at %v, want 500 at start", www.metrics[0].max, www.metrics[0].peak)
+	}
+	if www.process.PSS() != 500 || www.process.USS() != 250 {
+		t.Errorf("www sorts by PSS %d and USS %d, want the peaks 500 and 250", www.process.PSS(), www.process.USS())
+	}
+	if !root.recorded || !www.first.Equal(start) || !www.last.Equal(end) {
+		t.Errorf("www seen %v to %v, want the whole recording", www.first, www.last)
+	}
+
+	rows = processRows(records, start, end)
+	if len(rows) != 4 {
+		t.Fatalf("process rows = %d, want 4", len(rows))
+	}
+	if exited := rows[2]; exited.process.PID() != 3 || !exited.recorded || !exited.last.Equal(start) {
+		t.Errorf("PID 3 row = %+v, want seen in the first sample only", exited)
+	}
+}
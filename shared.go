@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"runtime"
+	"slices"
+	"syscall"
+	"time"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/jedib0t/go-pretty/v6/text"
+)
+
+// number of page frames mapped by both processes
+func sharedPages(a, b PageFrames) int {
+	if len(b) < len(a) {
+		a, b = b, a
+	}
+	shared := 0
+	for pfn := range a {
+		if _, ok := b[pfn]; ok {
+			shared++
+		}
+	}
+	return shared
+}
+
+// renders a matrix of resident memory shared between each pair of processes;
+// the diagonal holds the resident memory of the process itself
+func renderSharedMatrix(processes []Process, humanReadable bool) {
+	t := table.NewWriter()
+
+	t.SetOutputMirror(os.Stdout)
+	t.SuppressTrailingSpaces()
+	t.Style().Options.DrawBorder = false
+	t.Style().Options.SeparateHeader = false
+	t.Style().Options.SeparateColumns = false
+	t.Style().Options.SeparateRows = false
+
+	header := table.Row{"PID", "Command"}
+	columnConfigs := []table.ColumnConfig{
+		{Number: 1, Align: text.AlignRight, AlignHeader: text.AlignRight},
+		{Number: 2, Align: text.AlignLeft, AlignHeader: text.AlignLeft},
+	}
+	for i, process := range processes {
+		header = append(header, process.PID())
+		columnConfigs = append(columnConfigs, table.ColumnConfig{Number: i + 3, Align: text.AlignRight, AlignHeader: text.AlignRight})
+	}
+	t.SetColumnConfigs(columnConfigs)
+	t.AppendHeader(header)
+
+	for i, a := range processes {
+		row := table.Row{a.PID(), a.stat.comm}
+		for j, b := range processes {
+			pages := len(a.frames)
+			if i != j {
+				pages = sharedPages(a.frames, b.frames)
+			}
+			row = append(row, kiloBytesToString(pages*pageSizeKiB, humanReadable))
+		}
+		t.AppendRow(row)
+	}
+
+	t.Render()
+}
+
+func printSharedUsage() {
+	fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s shared [OPTION]... PID...\n", os.Args[0])
+	fmt.Fprintf(flag.CommandLine.Output(), `Show resident memory shared between each pair of processes, and the memory
+that would be freed if all of them exited (requires root).
+Options:
+  --help                %s
+  -h, --human-readable  %s
+  -j, --jobs            %s
+  -t, --timeout         %s
+`,
+		flagHelpDescription,
+		flagHumanReadableDescription,
+		flagJobsDescription,
+		flagTimeoutDescription)
+}
+
+func runShared(args []string) int {
+	flags := flag.NewFlagSet("shared", flag.ExitOnError)
+	var help, humanReadable bool
+	var jobs int
+	var timeout time.Duration
+	flags.BoolVar(&help, "help", false, flagHelpDescription)
+	flags.BoolVar(&humanReadable, "human-readable", false, flagHumanReadableDescription)
+	flags.BoolVar(&humanReadable, "h", false, flagHumanReadableDescription)
+	flags.IntVar(&jobs, "jobs", runtime.NumCPU(), flagJobsDescription)
+	flags.IntVar(&jobs, "j", runtime.NumCPU(), flagJobsDescription)
+	flags.DurationVar(&timeout, "timeout", 0, flagTimeoutDescription)
+	flags.DurationVar(&timeout, "t", 0, flagTimeoutDescription)
+	flags.Usage = printSharedUsage
+	flags.Parse(args)
+
+	if help {
+		printSharedUsage()
+		return ExitSuccess
+	}
+
+	pids := parsePids(flags.Args())
+	if len(pids) == 0 {
+		printSharedUsage()
+		return ExitInvalidArguments
+	}
+
+	kpages, err := openKPages()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: shared requires root: %v\n", err)
+		return ExitFailure
+	}
+	defer kpages.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	processes := collectProcesses(ctx, pids, CollectOptions{jobs: jobs, timeout: timeout, exact: kpages, keepFrames: true})
+	stop()
+
+	// incomplete processes have no page frames to compare
+	processes = slices.DeleteFunc(processes, func(p Process) bool {
+		return p.incomplete
+	})
+	if len(processes) == 0 {
+		fmt.Fprintf(os.Stderr, "error: none of the processes could be read\n")
+		return ExitFailure
+	}
+	sortProcesses(processes, "pid", false)
+
+	renderSharedMatrix(processes, humanReadable)
+
+	frames := make([]PageFrames, len(processes))
+	ussSum := 0
+	for i, process := range processes {
+		frames[i] = process.frames
+		ussSum += process.USS()
+	}
+	unique, err := kpages.setUnique(frames)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return ExitFailure
+	}
+	fmt.Printf("\nSum of USS:                      %s\n", kiloBytesToString(ussSum, humanReadable))
+	fmt.Printf("Group USS (freed if all exited): %s\n", kiloBytesToString(int(unique)*pageSizeKiB, humanReadable))
+	return ExitSuccess
+}
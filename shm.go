@@ -0,0 +1,244 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/jedib0t/go-pretty/v6/text"
+)
+
+const (
+	ShmPosix      = "posix"
+	ShmMemfd      = "memfd"
+	ShmSysV       = "sysv"
+	ShmSharedAnon = "shared-anon"
+)
+
+// classifies shmem-backed mappings: POSIX shared memory in /dev/shm,
+// memfd_create(2) files, SysV shared memory segments, and shared
+// anonymous mappings, which the kernel shows as a deleted /dev/zero
+func shmType(m Mapping) (string, bool) {
+	switch {
+	case strings.HasPrefix(m.path, "/dev/shm/"):
+		return ShmPosix, true
+	case strings.HasPrefix(m.path, "/memfd:"):
+		return ShmMemfd, true
+	case strings.HasPrefix(m.path, "/SYSV"):
+		return ShmSysV, true
+	case m.path == "/dev/zero (deleted)" && m.isShared():
+		return ShmSharedAnon, true
+	}
+	return "", false
+}
+
+// a process mapping a shared memory object
+type ShmUser struct {
+	pid  int
+	comm string
+	rss  int
+	pss  int
+}
+
+// a shared memory object, identified by device and inode
+type ShmObject struct {
+	name  string
+	kind  string
+	size  int // KiB
+	rss   int
+	pss   int
+	users []ShmUser
+}
+
+// sizes of SysV shared memory segments in KiB, by shmid,
+// which is the inode number of their mappings
+func sysvShmSizes() map[uint64]int {
+	sizes := map[uint64]int{}
+	contents, err := os.ReadFile(procDir + "/sysvipc/shm")
+	if err != nil {
+		return sizes
+	}
+	for i, line := range strings.Split(string(contents), "\n") {
+		fields := strings.Fields(line)
+		// key shmid perms size ...
+		if i == 0 || len(fields) < 4 {
+			continue
+		}
+		shmid, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		if size, err := strconv.Atoi(fields[3]); err == nil {
+			sizes[shmid] = size / 1024
+		}
+	}
+	return sizes
+}
+
+// groups the shmem-backed mappings of all processes by object
+func shmObjects(processes []Process) []ShmObject {
+	sysvSizes := sysvShmSizes()
+	objects := map[string]*ShmObject{}
+	var keys []string
+
+	for _, process := range processes {
+		users := map[string]*ShmUser{}
+		for _, mapping := range process.mappings {
+			kind, ok := shmType(mapping)
+			if !ok {
+				continue
+			}
+			key := fmt.Sprintf("%s:%d", mapping.device, mapping.inode)
+			object, ok := objects[key]
+			if !ok {
+				object = &ShmObject{name: mapping.name(), kind: kind}
+				objects[key] = object
+				keys = append(keys, key)
+				if kind == ShmSysV {
+					object.size = sysvSizes[mapping.inode]
+				} else if info, err := os.Stat(mapping.name()); err == nil && kind == ShmPosix {
+					object.size = int(info.Size() / 1024)
+				}
+			}
+			// fall back to the largest mapping of the object
+			object.size = max(object.size, int(mapping.end-mapping.start)/1024)
+			object.rss += mapping.RSS()
+			object.pss += mapping.PSS()
+
+			// a process may map an object more than once
+			user, ok := users[key]
+			if !ok {
+				user = &ShmUser{pid: process.PID(), comm: process.stat.comm}
+				users[key] = user
+			}
+			user.rss += mapping.RSS()
+			user.pss += mapping.PSS()
+		}
+		for key, user := range users {
+			objects[key].users = append(objects[key].users, *user)
+		}
+	}
+
+	result := make([]ShmObject, 0, len(keys))
+	for _, key := range keys {
+		object := objects[key]
+		slices.SortFunc(object.users, func(a, b ShmUser) int {
+			return b.pss - a.pss
+		})
+		result = append(result, *object)
+	}
+	slices.SortStableFunc(result, func(a, b ShmObject) int {
+		return b.pss - a.pss
+	})
+	return result
+}
+
+func renderShmObjects(objects []ShmObject, isWideOutput bool, humanReadable bool) {
+	t := table.NewWriter()
+
+	t.SetOutputMirror(os.Stdout)
+	t.SuppressTrailingSpaces()
+	t.SetColumnConfigs([]table.ColumnConfig{
+		{Number: 1, Align: text.AlignLeft, AlignHeader: text.AlignLeft},
+		{Number: 2, Align: text.AlignLeft, AlignHeader: text.AlignLeft},
+		{Number: 3, Align: text.AlignRight, AlignHeader: text.AlignRight},
+		{Number: 4, Align: text.AlignRight, AlignHeader: text.AlignRight},
+		{Number: 5, Align: text.AlignRight, AlignHeader: text.AlignRight},
+		{Number: 6, Align: text.AlignRight, AlignHeader: text.AlignRight},
+		{Number: 7, Align: text.AlignLeft, AlignHeader: text.AlignLeft},
+	})
+	t.Style().Options.DrawBorder = false
+	t.Style().Options.SeparateHeader = false
+	t.Style().Options.SeparateColumns = false
+	t.Style().Options.SeparateRows = false
+
+	t.AppendHeader(table.Row{"Object", "Type", "Size", "Procs", "RSS", "PSS", "Processes (PID:comm:PSS)"})
+	for _, object := range objects {
+		users := make([]string, len(object.users))
+		for i, user := range object.users {
+			users[i] = fmt.Sprintf("%d:%s:%s", user.pid, user.comm, kiloBytesToString(user.pss, humanReadable))
+		}
+		processes := strings.Join(users, " ")
+		if !isWideOutput && len(object.users) > 3 {
+			processes = strings.Join(users[:3], " ") + fmt.Sprintf(" (+%d)", len(object.users)-3)
+		}
+		t.AppendRow(table.Row{
+			object.name,
+			object.kind,
+			kiloBytesToString(object.size, humanReadable),
+			len(object.users),
+			kiloBytesToString(object.rss, humanReadable),
+			kiloBytesToString(object.pss, humanReadable),
+			processes,
+		})
+	}
+
+	t.Render()
+}
+
+func printShmUsage() {
+	fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s shm [OPTION]... [PID]...\n", os.Args[0])
+	fmt.Fprintf(flag.CommandLine.Output(), `List shared memory objects (POSIX shm, memfd, SysV shm, shared anonymous
+mappings) with the processes mapping them.
+Options:
+  --help                %s
+  -w, --wide            %s
+  -h, --human-readable  %s
+  -j, --jobs            %s
+  -t, --timeout         %s
+`,
+		flagHelpDescription,
+		"list all processes mapping an object",
+		flagHumanReadableDescription,
+		flagJobsDescription,
+		flagTimeoutDescription)
+}
+
+func runShm(args []string) int {
+	flags := flag.NewFlagSet("shm", flag.ExitOnError)
+	var help, wideOutput, humanReadable bool
+	var jobs int
+	var timeout time.Duration
+	flags.BoolVar(&help, "help", false, flagHelpDescription)
+	flags.BoolVar(&wideOutput, "wide", false, flagWideDescription)
+	flags.BoolVar(&wideOutput, "w", false, flagWideDescription)
+	flags.BoolVar(&humanReadable, "human-readable", false, flagHumanReadableDescription)
+	flags.BoolVar(&humanReadable, "h", false, flagHumanReadableDescription)
+	flags.IntVar(&jobs, "jobs", runtime.NumCPU(), flagJobsDescription)
+	flags.IntVar(&jobs, "j", runtime.NumCPU(), flagJobsDescription)
+	flags.DurationVar(&timeout, "timeout", 0, flagTimeoutDescription)
+	flags.DurationVar(&timeout, "t", 0, flagTimeoutDescription)
+	flags.Usage = printShmUsage
+	flags.Parse(args)
+
+	if help {
+		printShmUsage()
+		return ExitSuccess
+	}
+
+	pids, err := parsePidArgs(flags.Args())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return ExitInvalidArguments
+	}
+	if len(pids) == 0 {
+		pids = allProcesses()
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	processes := collectProcesses(ctx, pids, CollectOptions{jobs: jobs, timeout: timeout, mappings: true})
+	stop()
+	reportIncomplete(processes)
+
+	renderShmObjects(shmObjects(processes), wideOutput, humanReadable)
+	return ExitSuccess
+}
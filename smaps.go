@@ -5,7 +5,6 @@ import (
 	"fmt"
 	"log"
 	"os"
-	"reflect"
 	"strconv"
 	"strings"
 )
@@ -15,6 +14,13 @@ const (
 	StatPSS          = "pss"
 	StatPrivateClean = "private_clean"
 	StatPrivateDirty = "private_dirty"
+	StatPssAnon      = "pss_anon"
+	StatPssFile      = "pss_file"
+	StatPssShmem     = "pss_shmem"
+	StatSwapPss      = "swappss"
+	StatSharedClean  = "shared_clean"
+	StatSharedDirty  = "shared_dirty"
+	StatKSM          = "ksm"
 )
 
 type SmemHeader struct {
@@ -27,12 +33,6 @@ type SmemStat struct {
 	value int
 }
 
-type SmemRollupRaw struct {
-	pid      int
-	contents string
-	err      error
-}
-
 type SmemRollup struct {
 	pid    int
 	header SmemHeader
@@ -55,6 +55,10 @@ func (r SmemRollup) RSS() int {
 	return r.stats[StatRSS]
 }
 
+func (r SmemRollup) Swap() int {
+	return r.stats[StatSwap]
+}
+
 func readSmapsRollup(pid int) (string, error) {
 	path := fmt.Sprintf("%s/%d/smaps_rollup", procDir, pid)
 	contents, err := os.ReadFile(path)
@@ -78,11 +82,6 @@ func readSmapsRollup(pid int) (string, error) {
 	}
 }
 
-func smapsRollupReader(pid int, output chan SmemRollupRaw) {
-	contents, err := readSmapsRollup(pid)
-	output <- SmemRollupRaw{pid, contents, err}
-}
-
 func parseSmapsRollup(pid int, contents string) SmemRollup {
 	lines := strings.Split(contents, "\n")
 	header := SmemHeader{0, 0}
@@ -107,17 +106,6 @@ func parseSmapsRollup(pid int, contents string) SmemRollup {
 	return SmemRollup{pid, header, stats}
 }
 
-func smapsRollupParser(pid int, input chan SmemRollupRaw, output chan SmemRollup) {
-	//fmt.Printf("smapsRollupParser for PID %d reading\n", pid)
-	contents := <-input
-	//fmt.Printf("smapsRollupParser for PID %d read %d bytes\n", pid, len(contents))
-	if contents.err != nil || len(contents.contents) == 0 {
-		output <- SmemRollup{pid, SmemHeader{0, 0}, nil}
-		return
-	}
-	output <- parseSmapsRollup(contents.pid, contents.contents)
-}
-
 func parseHeaderLine(headerLine string) SmemHeader {
 	//fmt.Printf("parseHeaderLine: %s\n", headerLine)
 	addressParts := strings.Split(headerLine, " ")
@@ -151,79 +139,3 @@ func parseStatLine(statLine string) (SmemStat, error) {
 	//fmt.Printf("parseStatLine: %s => %d\n", key, value)
 	return SmemStat{key, value}, nil
 }
-
-// dispatches smem_rollup file parser goroutines:
-// - one file reader goroutine per pid
-// - one parser goroutine per pid
-func dispatchSmemRollupParsers(pids []int) map[int](chan SmemRollup) {
-	pidSmemRollupParserChannelMap := map[int](chan SmemRollup){}
-	for _, pid := range pids {
-		chSmemRollupReaderOutput := make(chan SmemRollupRaw, 1)
-		go smapsRollupReader(pid, chSmemRollupReaderOutput)
-
-		chSmemRollupParserOutput := make(chan SmemRollup, 1)
-		pidSmemRollupParserChannelMap[pid] = chSmemRollupParserOutput
-		go smapsRollupParser(pid, chSmemRollupReaderOutput, chSmemRollupParserOutput)
-	}
-	return pidSmemRollupParserChannelMap
-}
-
-// iterative reducer
-// iterates over channels and waits for them
-func reduceSmemRollupParsers(pidSmemRollupParserChannelMap map[int](chan SmemRollup)) []SmemRollup {
-	var rollupSlice []SmemRollup
-	for _, ch := range pidSmemRollupParserChannelMap {
-		for rollup := range ch {
-			if len(rollup.stats) > 0 {
-				rollupSlice = append(rollupSlice, rollup)
-			}
-			close(ch)
-		}
-	}
-	return rollupSlice
-}
-
-// reflect.select reducer
-// selects a channel that has data using reflect.SelectCase
-// because of the overhead of reflect.SelectCase, in this use case it's not really faster
-func reduceSmemRollupParsersSelect(pidSmemRollupParserChannelMap map[int](chan SmemRollup)) []SmemRollup {
-	numCases := len(pidSmemRollupParserChannelMap)
-	pids := make([]int, numCases)
-	i := 0
-	for pid := range pidSmemRollupParserChannelMap {
-		pids[i] = pid
-		i++
-	}
-
-	parserCases := make([]reflect.SelectCase, numCases)
-
-	for i := range pids {
-		ch := pidSmemRollupParserChannelMap[pids[i]]
-		parserCases[i] = reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ch)}
-	}
-
-	var rollupSlice []SmemRollup
-
-	remainingParsers := len(parserCases)
-	for remainingParsers > 0 {
-		chosen, recv, ok := reflect.Select(parserCases)
-		if !ok {
-			fmt.Fprintf(os.Stderr, "reduceSmemRollupParsersSelect: Selected channel %d has been closed, zeroing out the channel to disable the case\n", chosen)
-			parserCases[chosen].Chan = reflect.ValueOf(nil)
-			continue
-		}
-
-		rollup := recv.Interface().(SmemRollup)
-		//fmt.Printf("Read from channel %d %#v and received %v\n", chosen, pidSmemRollupParserChannelMap[pids[chosen]], rollup)
-
-		remainingParsers -= 1
-		close(pidSmemRollupParserChannelMap[pids[chosen]])
-		parserCases[chosen].Chan = reflect.ValueOf(nil)
-
-		if len(rollup.stats) > 0 {
-			rollupSlice = append(rollupSlice, rollup)
-			//fmt.Printf("PID %d: %s\n", pids[chosen], parsedLine)
-		}
-	}
-	return rollupSlice
-}
@@ -6,44 +6,62 @@ import (
 	"strings"
 )
 
-type RollupGetter[T cmp.Ordered] func(SmemRollup) T
-type RollupComparator func(SmemRollup, SmemRollup) int
+type ProcessGetter[T cmp.Ordered] func(Process) T
+type ProcessComparator func(Process, Process) int
 
-func makeComparator[T cmp.Ordered](getter RollupGetter[T]) RollupComparator {
-	return func(a, b SmemRollup) int {
+func makeComparator[T cmp.Ordered](getter ProcessGetter[T]) ProcessComparator {
+	return func(a, b Process) int {
 		return cmp.Compare(getter(a), getter(b))
 	}
 }
 
-// Sorts rollups by one of the supported keys.
+// fixed sort keys, besides optional columns
+var sortKeys = []string{"pid", "threads", "uss", "pss", "rss", "swap", "user", "command"}
+
+// reports whether key is a fixed sort key or the name of an optional column
+func isSortKey(key string) bool {
+	_, found := findColumn(key)
+	return found || slices.Contains(sortKeys, strings.ToLower(key))
+}
+
+// Compares processes by one of the supported keys.
 // Keys are validated upstream.
 // Helper abstractions:
-// comparator function -- takes two SmemRollups and compares them
+// comparator function -- takes two Processes and compares them
 // getter function -- used by comparator internally to obtain values to feed into cmp.Compare
 // comparator factory -- takes a getter function and returns a comparator function
-func sortRollups(rollups []SmemRollup, pidOwnersMap map[int]PidOwner, cmdlineMap map[int]string, key string, reverseOrder bool) []SmemRollup {
-	comparators := map[string]RollupComparator{
-		"pid": makeComparator(SmemRollup.PID),
-		"uss": makeComparator(SmemRollup.USS),
-		"pss": makeComparator(SmemRollup.PSS),
-		"rss": makeComparator(SmemRollup.RSS),
-		"user": makeComparator(func(r SmemRollup) string {
-			return pidOwnersMap[r.PID()].username
-		}),
-		"command": makeComparator(func(r SmemRollup) string {
-			return cmdlineMap[r.PID()]
-		}),
+func processComparator(key string, reverseOrder bool) ProcessComparator {
+	comparators := map[string]ProcessComparator{
+		"pid":     makeComparator(Process.PID),
+		"threads": makeComparator(Process.Threads),
+		"uss":     makeComparator(Process.USS),
+		"pss":     makeComparator(Process.PSS),
+		"rss":     makeComparator(Process.RSS),
+		"swap":    makeComparator(Process.Swap),
+		"user":    makeComparator(Process.User),
+		"command": makeComparator(Process.Command),
 	}
 
-	comparator := comparators[strings.ToLower(key)]
+	comparator, ok := comparators[strings.ToLower(key)]
+	if column, found := findColumn(key); !ok && found {
+		if column.text != nil {
+			comparator = makeComparator(column.text)
+		} else {
+			comparator = makeComparator(column.value)
+		}
+	}
 
-	slices.SortFunc(rollups, func(a, b SmemRollup) int {
+	return func(a, b Process) int {
 		c := comparator(a, b)
 		if reverseOrder {
 			c *= -1
 		}
 		return c
-	})
+	}
+}
 
-	return rollups
+// sorts processes by one of the supported keys
+func sortProcesses(processes []Process, key string, reverseOrder bool) []Process {
+	slices.SortFunc(processes, processComparator(key, reverseOrder))
+	return processes
 }
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// per-process flags, see include/linux/sched.h
+const pfKthread = 0x00200000
+
+// selected fields of /proc/PID/stat, see proc_pid_stat(5)
+type ProcStat struct {
+	pid       int
+	comm      string
+	state     string
+	ppid      int
+	flags     uint64
+	threads   int
+	startTime uint64 // clock ticks after boot
+	processor int    // CPU the process last ran on
+}
+
+func readProcStat(pid int) (ProcStat, error) {
+	path := fmt.Sprintf("%s/%d/stat", procDir, pid)
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return ProcStat{}, err
+	}
+	return parseProcStat(pid, string(contents))
+}
+
+func parseProcStat(pid int, contents string) (ProcStat, error) {
+	// comm is enclosed in parentheses and may itself contain spaces and parentheses
+	open := strings.IndexByte(contents, '(')
+	closing := strings.LastIndexByte(contents, ')')
+	if open < 0 || closing < open {
+		return ProcStat{}, fmt.Errorf("malformed stat for PID %d", pid)
+	}
+	comm := contents[open+1 : closing]
+
+	// fields after comm, starting with field 3 (state)
+	fields := strings.Fields(contents[closing+1:])
+	if len(fields) < 20 {
+		return ProcStat{}, fmt.Errorf("short stat for PID %d: %d fields", pid, len(fields))
+	}
+	field := func(n int) string {
+		return fields[n-3]
+	}
+
+	ppid, err := strconv.Atoi(field(4))
+	if err != nil {
+		return ProcStat{}, err
+	}
+	flags, err := strconv.ParseUint(field(9), 10, 64)
+	if err != nil {
+		return ProcStat{}, err
+	}
+	threads, err := strconv.Atoi(field(20))
+	if err != nil {
+		return ProcStat{}, err
+	}
+	startTime, err := strconv.ParseUint(field(22), 10, 64)
+	if err != nil {
+		return ProcStat{}, err
+	}
+	// field 39, missing on very old kernels
+	processor := 0
+	if len(fields) >= 39-2 {
+		processor, _ = strconv.Atoi(field(39))
+	}
+	return ProcStat{pid, comm, field(3), ppid, flags, threads, startTime, processor}, nil
+}
+
+// kernel threads have no user space memory and no command line
+func (s ProcStat) isKernelThread() bool {
+	return s.flags&pfKthread != 0
+}
+
+func (s ProcStat) isZombie() bool {
+	return s.state == "Z"
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// selected fields of /proc/PID/status, see proc_pid_status(5)
+type ProcStatus struct {
+	tgid    int
+	threads int
+	// memory counters (Vm*, Rss*, HugetlbPages) in KiB, keyed by lower case name
+	counters map[string]int
+}
+
+func readProcStatus(pid int) (ProcStatus, error) {
+	path := fmt.Sprintf("%s/%d/status", procDir, pid)
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return ProcStatus{}, err
+	}
+	return parseProcStatus(string(contents)), nil
+}
+
+func parseProcStatus(contents string) ProcStatus {
+	status := ProcStatus{counters: map[string]int{}}
+	for _, line := range strings.Split(contents, "\n") {
+		key, value, found := strings.Cut(line, ":")
+		if !found {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		switch key {
+		case "Tgid":
+			status.tgid, _ = strconv.Atoi(value)
+		case "Threads":
+			status.threads, _ = strconv.Atoi(value)
+		default:
+			if kb, found := strings.CutSuffix(value, " kB"); found {
+				if n, err := strconv.Atoi(strings.TrimSpace(kb)); err == nil {
+					status.counters[strings.ToLower(key)] = n
+				}
+			}
+		}
+	}
+	return status
+}
+
+// a task (thread) of a process
+type Task struct {
+	tid  int
+	name string
+}
+
+// lists the tasks under /proc/PID/task with their names
+func readTasks(pid int) ([]Task, error) {
+	taskDir := fmt.Sprintf("%s/%d/task", procDir, pid)
+	files, err := os.ReadDir(taskDir)
+	if err != nil {
+		return nil, err
+	}
+	var tasks []Task
+	for _, file := range files {
+		tid, err := strconv.Atoi(file.Name())
+		if err != nil {
+			continue
+		}
+		name, err := os.ReadFile(fmt.Sprintf("%s/%d/comm", taskDir, tid))
+		if err != nil {
+			// thread exited in the meantime
+			continue
+		}
+		tasks = append(tasks, Task{tid, strings.TrimSuffix(string(name), "\n")})
+	}
+	return tasks, nil
+}
+
+// resolves a thread ID to the ID of its thread group (process);
+// /proc/TID exists for every thread even though it is not listed
+func threadGroupID(tid int) (int, error) {
+	status, err := readProcStatus(tid)
+	if err != nil {
+		return 0, err
+	}
+	if status.tgid == 0 {
+		return tid, nil
+	}
+	return status.tgid, nil
+}
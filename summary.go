@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"runtime"
+	"syscall"
+	"time"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/jedib0t/go-pretty/v6/text"
+)
+
+// totals over all processes, in KiB
+type ProcessTotals struct {
+	count      int
+	unreadable int // processes whose memory could not be read (e.g. not running as root)
+	pss        int
+	pssAnon    int
+	pssFile    int
+	pssShmem   int
+	swapPss    int
+}
+
+func sumProcesses(processes []Process) ProcessTotals {
+	totals := ProcessTotals{}
+	for _, process := range processes {
+		if process.stat.isKernelThread() || process.stat.isZombie() {
+			continue
+		}
+		if process.incomplete || len(process.rollup.stats) == 0 {
+			totals.unreadable++
+			continue
+		}
+		stats := process.rollup.stats
+		totals.count++
+		totals.pss += process.PSS()
+		totals.pssAnon += stats[StatPssAnon]
+		totals.pssFile += stats[StatPssFile]
+		totals.pssShmem += stats[StatPssShmem]
+		totals.swapPss += stats[StatSwapPss]
+	}
+	return totals
+}
+
+// a line of the summary report, a heading if it has no value
+type SummaryLine struct {
+	label string
+	value int
+	isSet bool
+}
+
+func heading(label string) SummaryLine {
+	return SummaryLine{label, 0, false}
+}
+
+func line(label string, value int) SummaryLine {
+	return SummaryLine{"  " + label, value, true}
+}
+
+// reconciles process PSS with /proc/meminfo
+//
+// Memory in use (MemTotal - MemFree) that no process PSS accounts for
+// is broken down into estimates for page cache, shared memory that is
+// not mapped, kernel memory and the hugetlb pool; what remains is other.
+func summaryLines(totals ProcessTotals, meminfo map[string]int) []SummaryLine {
+	used := meminfo["MemTotal"] - meminfo["MemFree"]
+	unattributed := used - totals.pss
+
+	pageCache := max(meminfo["Buffers"]+meminfo["Cached"]-meminfo["Shmem"]-totals.pssFile, 0)
+	unmappedShmem := max(meminfo["Shmem"]-totals.pssShmem, 0)
+	kernel := meminfo["Slab"] + meminfo["KernelStack"] + meminfo["PageTables"] +
+		meminfo["SecPageTables"] + meminfo["Percpu"]
+	hugetlb := hugetlbTotal(meminfo)
+	other := unattributed - pageCache - unmappedShmem - kernel - hugetlb
+
+	return []SummaryLine{
+		heading(fmt.Sprintf("Processes (%d)", totals.count)),
+		line("PSS", totals.pss),
+		line("  anonymous", totals.pssAnon),
+		line("  file", totals.pssFile),
+		line("  shmem", totals.pssShmem),
+		line("Swap PSS", totals.swapPss),
+		heading("System (/proc/meminfo)"),
+		line("MemTotal", meminfo["MemTotal"]),
+		line("MemFree", meminfo["MemFree"]),
+		line("MemAvailable", meminfo["MemAvailable"]),
+		line("Used (MemTotal - MemFree)", used),
+		line("Buffers", meminfo["Buffers"]),
+		line("Cached", meminfo["Cached"]),
+		line("Shmem", meminfo["Shmem"]),
+		line("Slab", meminfo["Slab"]),
+		line("KernelStack", meminfo["KernelStack"]),
+		line("PageTables", meminfo["PageTables"]),
+		line("AnonPages", meminfo["AnonPages"]),
+		line("HugePages", hugetlb),
+		heading("Not attributable to processes"),
+		line("Used - process PSS", unattributed),
+		line("  page cache (not mapped)", pageCache),
+		line("  shmem, tmpfs, SysV shm (not mapped)", unmappedShmem),
+		line("  kernel (slab, stacks, page tables, percpu)", kernel),
+		line("  hugetlb pool", hugetlb),
+		line("  other", other),
+	}
+}
+
+func renderSummary(lines []SummaryLine, humanReadable bool) {
+	t := table.NewWriter()
+
+	t.SetOutputMirror(os.Stdout)
+	t.SuppressTrailingSpaces()
+	t.SetColumnConfigs([]table.ColumnConfig{
+		{Number: 1, Align: text.AlignLeft},
+		{Number: 2, Align: text.AlignRight},
+	})
+	t.Style().Options.DrawBorder = false
+	t.Style().Options.SeparateHeader = false
+	t.Style().Options.SeparateColumns = false
+	t.Style().Options.SeparateRows = false
+
+	for _, line := range lines {
+		if line.isSet {
+			t.AppendRow(table.Row{line.label, kiloBytesToString(line.value, humanReadable)})
+		} else {
+			t.AppendRow(table.Row{line.label, ""})
+		}
+	}
+
+	t.Render()
+}
+
+const flagCgroupsDescription = "number of cgroups to show pressure for"
+
+func printSummaryUsage() {
+	fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s summary [OPTION]...\n", os.Args[0])
+	fmt.Fprintf(flag.CommandLine.Output(), `Compare total PSS of all processes with /proc/meminfo, and show memory
+pressure of the system and of the cgroups with the largest PSS.
+Options:
+  --help                %s
+  -h, --human-readable  %s
+  -j, --jobs            %s
+  -t, --timeout         %s
+  --cgroups             %s
+`,
+		flagHelpDescription,
+		flagHumanReadableDescription,
+		flagJobsDescription,
+		flagTimeoutDescription,
+		flagCgroupsDescription)
+}
+
+func runSummary(args []string) int {
+	flags := flag.NewFlagSet("summary", flag.ExitOnError)
+	var help, humanReadable bool
+	var jobs, cgroups int
+	var timeout time.Duration
+	flags.BoolVar(&help, "help", false, flagHelpDescription)
+	flags.BoolVar(&humanReadable, "human-readable", false, flagHumanReadableDescription)
+	flags.BoolVar(&humanReadable, "h", false, flagHumanReadableDescription)
+	flags.IntVar(&jobs, "jobs", runtime.NumCPU(), flagJobsDescription)
+	flags.IntVar(&jobs, "j", runtime.NumCPU(), flagJobsDescription)
+	flags.DurationVar(&timeout, "timeout", 0, flagTimeoutDescription)
+	flags.DurationVar(&timeout, "t", 0, flagTimeoutDescription)
+	flags.IntVar(&cgroups, "cgroups", 10, flagCgroupsDescription)
+	flags.Usage = printSummaryUsage
+	flags.Parse(args)
+
+	if help {
+		printSummaryUsage()
+		return ExitSuccess
+	}
+
+	meminfo, err := readMeminfo()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return ExitFailure
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	// OOM info includes the cgroup of each process
+	processes := collectProcesses(ctx, allProcesses(), CollectOptions{jobs: jobs, timeout: timeout, allTasks: true, oom: true})
+	stop()
+
+	totals := sumProcesses(processes)
+	if totals.unreadable > 0 {
+		fmt.Fprintf(os.Stderr, "warning: memory of %d processes could not be read, totals are incomplete\n", totals.unreadable)
+	}
+	renderSummary(summaryLines(totals, meminfo), humanReadable)
+	fmt.Println()
+	renderPressure(processes, cgroups, humanReadable)
+	return ExitSuccess
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+const testMeminfo = `MemTotal:       16000000 kB
+MemFree:         2000000 kB
+MemAvailable:    9000000 kB
+Buffers:          300000 kB
+Cached:          6000000 kB
+SwapCached:            0 kB
+AnonPages:       3500000 kB
+Shmem:            500000 kB
+Slab:             700000 kB
+KernelStack:       20000 kB
+PageTables:        60000 kB
+SecPageTables:         0 kB
+Percpu:            20000 kB
+HugePages_Total:     256
+HugePages_Free:      256
+Hugepagesize:       2048 kB
+`
+
+// the value of each line of the summary by label without its indent,
+// headings as -1
+func summaryValues(lines []SummaryLine) map[string]int {
+	values := map[string]int{}
+	for _, line := range lines {
+		label := strings.TrimSpace(line.label)
+		if line.isSet {
+			values[label] = line.value
+		} else {
+			values[label] = -1
+		}
+	}
+	return values
+}
+
+func TestSummaryLines(t *testing.T) {
+	meminfo := parseMeminfo(testMeminfo)
+	if meminfo["MemTotal"] != 16000000 || meminfo["HugePages_Total"] != 256 {
+		t.Fatalf("parseMeminfo = %v", meminfo)
+	}
+	totals := ProcessTotals{count: 120, pss: 4000000, pssAnon: 3000000, pssFile: 800000, pssShmem: 200000, swapPss: 1000}
+	values := summaryValues(summaryLines(totals, meminfo))
+
+	want := map[string]int{
+		"Processes (120)":           -1,
+		"PSS":                       4000000,
+		"Used (MemTotal - MemFree)": 14000000,
+		"HugePages":                 256 * 2048,
+		"Used - process PSS":        10000000,
+		// buffers and cache, less shmem and the mapped files in PSS
+		"page cache (not mapped)":                    300000 + 6000000 - 500000 - 800000,
+		"shmem, tmpfs, SysV shm (not mapped)":        500000 - 200000,
+		"kernel (slab, stacks, page tables, percpu)": 700000 + 20000 + 60000 + 20000,
+		"hugetlb pool":                               256 * 2048,
+		"other":                                      10000000 - 5000000 - 300000 - 800000 - 256*2048,
+	}
+	for label, value := range want {
+		if got, ok := values[label]; !ok || got != value {
+			t.Errorf("%q = %d, want %d", label, got, value)
+		}
+	}
+}
+
+func TestSummaryLinesClamped(t *testing.T) {
+	// estimates are clamped at zero when the PSS of mapped files and shmem
+	// exceeds what meminfo counts
+	meminfo := map[string]int{"MemTotal": 1000, "MemFree": 100, "Cached": 300, "Shmem": 100, "Hugetlb": 50}
+	totals := ProcessTotals{pss: 900, pssFile: 400, pssShmem: 150}
+	values := summaryValues(summaryLines(totals, meminfo))
+	if values["page cache (not mapped)"] != 0 || values["shmem, tmpfs, SysV shm (not mapped)"] != 0 {
+		t.Errorf("estimates = %v, want zero rather than negative", values)
+	}
+	// Hugetlb covers pools of all huge page sizes
+	if values["hugetlb pool"] != 50 || values["other"] != -50 {
+		t.Errorf("hugetlb pool %d, other %d, want 50 and -50", values["hugetlb pool"], values["other"])
+	}
+}
+
+func TestSumProcesses(t *testing.T) {
+	process := func(pss, anon, file int) Process {
+		return Process{stat: ProcStat{state: "S"}, rollup: SmemRollup{stats: map[string]int{
+			StatPSS: pss, StatPssAnon: anon, StatPssFile: file, StatSwapPss: 1,
+		}}}
+	}
+	kernelThread := Process{stat: ProcStat{state: "S", flags: pfKthread}}
+	zombie := Process{stat: ProcStat{state: "Z"}}
+	unreadable := Process{stat: ProcStat{state: "S"}}
+	incomplete := process(0, 0, 0)
+	incomplete.incomplete = true
+
+	totals := sumProcesses([]Process{process(300, 200, 100), process(50, 50, 0), kernelThread, zombie, unreadable, incomplete})
+	want := ProcessTotals{count: 2, unreadable: 2, pss: 350, pssAnon: 250, pssFile: 100, swapPss: 2}
+	if totals != want {
+		t.Errorf("sumProcesses = %+v, want %+v", totals, want)
+	}
+}
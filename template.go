@@ -0,0 +1,117 @@
+package main
+
+import (
+	"io"
+	"maps"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// sizes in templates are KiB, or nil if collection did not finish
+func templateSize(value any, convert func(int) string) string {
+	kib, ok := value.(int)
+	if !ok {
+		return "?"
+	}
+	return convert(kib)
+}
+
+// helpers available in --format templates, besides those of text/template
+var templateFuncs = template.FuncMap{
+	"human": func(size any) string {
+		return templateSize(size, func(kib int) string { return kiloBytesToString(kib, true) })
+	},
+	"bytes": func(size any) string {
+		return templateSize(size, func(kib int) string { return strconv.Itoa(kib * 1024) })
+	},
+	"mib": func(size any) string {
+		return templateSize(size, func(kib int) string { return strconv.FormatFloat(float64(kib)/1024, 'f', 1, 64) })
+	},
+	"gib": func(size any) string {
+		return templateSize(size, func(kib int) string { return strconv.FormatFloat(float64(kib)/1024/1024, 'f', 2, 64) })
+	},
+	"trunc": func(width int, s string) string { return truncateCommand(s, width, false) },
+	"join":  func(sep string, elems []string) string { return strings.Join(elems, sep) },
+	"quote": strconv.Quote,
+}
+
+// parses a template executed for each process, ending in a newline unless
+// it already does
+func parseTemplate(format string) (*template.Template, error) {
+	if !strings.HasSuffix(format, "\n") {
+		format += "\n"
+	}
+	return template.New("format").Funcs(templateFuncs).Option("missingkey=error").Parse(format)
+}
+
+// the fields of a process available to templates: those of the other output
+// formats, process details, and every counter from smaps_rollup and status,
+// each under its lower case name
+func templateData(process Process, fields []Field, rollupStats []string) map[string]any {
+	data := map[string]any{
+		"ppid":       process.stat.ppid,
+		"uid":        process.owner.uid,
+		"comm":       process.stat.comm,
+		"state":      process.State(),
+		"threads":    process.Threads(),
+		"argv":       process.argv,
+		"incomplete": process.incomplete,
+	}
+	for _, name := range rollupStats {
+		data[name] = process.rollup.stats[name]
+	}
+	for _, counter := range statusCounters {
+		name := strings.ToLower(counter)
+		data[name] = process.status.counters[name]
+	}
+	for _, field := range fields {
+		data[field.name] = field.value(process)
+	}
+	return data
+}
+
+// names of the fields templateData provides, with the counters of
+// smaps_rollup of the running kernel, as found in our own
+func templateFieldNames(fields []Field) []string {
+	var rollupStats []string
+	if contents, err := readSmapsRollup(os.Getpid()); err == nil {
+		rollupStats = slices.Collect(maps.Keys(parseSmapsRollup(os.Getpid(), contents).stats))
+	}
+	names := slices.Collect(maps.Keys(templateData(Process{}, nil, rollupStats)))
+	for _, field := range fields {
+		names = append(names, field.name)
+	}
+	return names
+}
+
+// counters of smaps_rollup differ between kernels and processes, so any of
+// them is available for all processes
+func rollupStatNames(processes []Process) []string {
+	var names []string
+	for _, process := range processes {
+		for name := range process.rollup.stats {
+			if !slices.Contains(names, name) {
+				names = append(names, name)
+			}
+		}
+	}
+	return names
+}
+
+// render the template for each process, up to the first that fails
+func renderTemplate(out io.Writer, processes []Process, fields []Field, options RenderOptions) error {
+	rollupStats := rollupStatNames(processes)
+
+	var b strings.Builder
+	for _, process := range processes {
+		if err := options.template.Execute(&b, templateData(process, fields, rollupStats)); err != nil {
+			io.WriteString(out, b.String())
+			return err
+		}
+	}
+	_, err := io.WriteString(out, b.String())
+	return err
+}
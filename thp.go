@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+const thpDir = "/sys/kernel/mm/transparent_hugepage"
+
+// huge page counters from smaps_rollup, see proc_pid_smaps(5)
+var hugePageStats = []string{
+	"AnonHugePages",
+	"ShmemPmdMapped",
+	"FilePmdMapped",
+	"Shared_Hugetlb",
+	"Private_Hugetlb",
+}
+
+// share of anonymous memory backed by transparent huge pages, in percent
+func anonTHPPercent(p Process) int {
+	anon := p.rollup.stats["anonymous"]
+	if anon == 0 {
+		return 0
+	}
+	return p.rollup.stats["anonhugepages"] * 100 / anon
+}
+
+var thpColumns = func() []Column {
+	columns := []Column{}
+	for _, field := range hugePageStats {
+		columns = append(columns, rollupColumn(field))
+	}
+	columns = append(columns,
+		Column{name: "thp-anon", header: "THP% Anon", value: anonTHPPercent},
+		statusColumn("HugetlbPages"))
+	return columns
+}()
+
+var selectedSetting = regexp.MustCompile(`\[([^]]+)\]`)
+
+// the selected value of a THP setting, shown in brackets by the kernel
+func thpSetting(name string) string {
+	contents, err := os.ReadFile(thpDir + "/" + name)
+	if err != nil {
+		return "n/a"
+	}
+	if match := selectedSetting.FindStringSubmatch(string(contents)); match != nil {
+		return match[1]
+	}
+	return strings.TrimSpace(string(contents))
+}
+
+// system wide THP settings and huge page usage
+func thpSystemLine(humanReadable bool) string {
+	meminfo, err := readMeminfo()
+	if err != nil {
+		meminfo = map[string]int{}
+	}
+	size := func(key string) string {
+		return kiloBytesToString(meminfo[key], humanReadable)
+	}
+	return fmt.Sprintf("THP enabled: %s, defrag: %s, shmem: %s; "+
+		"AnonHugePages: %s, ShmemHugePages: %s, FileHugePages: %s; "+
+		"HugePages total: %d, free: %d, reserved: %d, surplus: %d, size: %s",
+		thpSetting("enabled"), thpSetting("defrag"), thpSetting("shmem_enabled"),
+		size("AnonHugePages"), size("ShmemHugePages"), size("FileHugePages"),
+		meminfo["HugePages_Total"], meminfo["HugePages_Free"],
+		meminfo["HugePages_Rsvd"], meminfo["HugePages_Surp"], size("Hugepagesize"))
+}
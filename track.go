@@ -0,0 +1,292 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/signal"
+	"slices"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/jedib0t/go-pretty/v6/text"
+	"golang.org/x/sys/unix"
+)
+
+const StatSwap = "swap"
+
+// identifies a mapping across samples by one of its ends and its path:
+// the heap grows up from a fixed start, while adjacent anonymous mappings
+// are merged into one that grows down to a lower start
+type MappingKey struct {
+	address uint64
+	path    string
+}
+
+// name of the mapping, or of the kind of anonymous region
+func (m Mapping) label() string {
+	if m.path != "" {
+		return m.path
+	}
+	if m.isShared() {
+		return "[anon shared]"
+	}
+	return "[anon]"
+}
+
+// change of a mapping between two samples, in KiB
+type MappingChange struct {
+	mapping      Mapping // as last seen, or before it was unmapped
+	change       string  // new, unmapped, grew or shrank
+	rss          int
+	privateDirty int
+	swap         int
+}
+
+// a tracked stat of a mapping, none of them for mappings absent from a sample
+func trackedStats(m *Mapping) (rss, privateDirty, swap int) {
+	if m == nil {
+		return 0, 0, 0
+	}
+	return m.stats[StatRSS], m.stats[StatPrivateDirty], m.stats[StatSwap]
+}
+
+// compares two samples of the mappings of a process, returning mappings
+// that appeared, disappeared, or changed in RSS, Private_Dirty or Swap,
+// in order of address
+func diffMappings(before, after []Mapping) []MappingChange {
+	byStart := make(map[MappingKey]*Mapping, len(before))
+	byEnd := make(map[MappingKey]*Mapping, len(before))
+	for i := range before {
+		byStart[MappingKey{before[i].start, before[i].path}] = &before[i]
+		byEnd[MappingKey{before[i].end, before[i].path}] = &before[i]
+	}
+	matched := make(map[*Mapping]bool, len(before))
+	match := func(m Mapping) *Mapping {
+		for _, old := range []*Mapping{byStart[MappingKey{m.start, m.path}], byEnd[MappingKey{m.end, m.path}]} {
+			if old != nil && !matched[old] {
+				matched[old] = true
+				return old
+			}
+		}
+		return nil
+	}
+
+	var changes []MappingChange
+	diff := func(old, new *Mapping, mapping Mapping) {
+		oldRSS, oldDirty, oldSwap := trackedStats(old)
+		newRSS, newDirty, newSwap := trackedStats(new)
+		change := MappingChange{mapping: mapping, rss: newRSS - oldRSS, privateDirty: newDirty - oldDirty, swap: newSwap - oldSwap}
+		switch {
+		case old == nil:
+			change.change = "new"
+		case new == nil:
+			change.change = "unmapped"
+		case change.rss+change.swap > 0 || change.rss+change.swap == 0 && change.privateDirty > 0:
+			change.change = "grew"
+		case change.rss != 0 || change.privateDirty != 0 || change.swap != 0:
+			change.change = "shrank"
+		default:
+			return
+		}
+		changes = append(changes, change)
+	}
+	for i := range after {
+		diff(match(after[i]), &after[i], after[i])
+	}
+	for i := range before {
+		if !matched[&before[i]] {
+			diff(&before[i], nil, before[i])
+		}
+	}
+
+	slices.SortFunc(changes, func(a, b MappingChange) int {
+		return cmp.Compare(a.mapping.start, b.mapping.start)
+	})
+	return changes
+}
+
+// renders a change in KiB with its sign, blank if nothing changed
+func deltaToString(value int, humanReadable bool) string {
+	switch {
+	case value > 0:
+		return "+" + kiloBytesToString(value, humanReadable)
+	case value < 0:
+		return "-" + kiloBytesToString(-value, humanReadable)
+	}
+	return ""
+}
+
+func renderMappingChanges(changes []MappingChange, isWideOutput bool, humanReadable bool) {
+	t := table.NewWriter()
+
+	t.SetOutputMirror(os.Stdout)
+	t.SuppressTrailingSpaces()
+	t.SetColumnConfigs([]table.ColumnConfig{
+		{Number: 1, Align: text.AlignLeft, AlignHeader: text.AlignLeft},
+		{Number: 2, Align: text.AlignLeft, AlignHeader: text.AlignLeft},
+		{Number: 3, Align: text.AlignLeft, AlignHeader: text.AlignLeft},
+		{Number: 4, Align: text.AlignRight, AlignHeader: text.AlignRight},
+		{Number: 5, Align: text.AlignRight, AlignHeader: text.AlignRight},
+		{Number: 6, Align: text.AlignRight, AlignHeader: text.AlignRight},
+		{Number: 7, Align: text.AlignRight, AlignHeader: text.AlignRight},
+		{Number: 8, Align: text.AlignLeft, AlignHeader: text.AlignLeft},
+	})
+	t.Style().Options.DrawBorder = false
+	t.Style().Options.SeparateHeader = false
+	t.Style().Options.SeparateColumns = false
+	t.Style().Options.SeparateRows = false
+
+	t.AppendHeader(table.Row{"Address", "Perms", "Change", "RSS", "RSS Δ", "Dirty Δ", "Swap Δ", "Mapping"})
+	for _, change := range changes {
+		rss := ""
+		if change.change != "unmapped" {
+			rss = kiloBytesToString(change.mapping.RSS(), humanReadable)
+		}
+		t.AppendRow(table.Row{
+			strconv.FormatUint(change.mapping.start, 16),
+			change.mapping.perms,
+			change.change,
+			rss,
+			deltaToString(change.rss, humanReadable),
+			deltaToString(change.privateDirty, humanReadable),
+			deltaToString(change.swap, humanReadable),
+			truncateCommand(change.mapping.label(), 60, isWideOutput),
+		})
+	}
+
+	t.Render()
+}
+
+// reads the mappings of a process, and its start time to notice PID reuse;
+// like collectProcess, the start time is read again after the mappings, so
+// that those of a process reusing the PID meanwhile are not returned
+func readTrackedMappings(pid int) ([]Mapping, uint64, error) {
+	pidfd := openPidfd(pid)
+	if pidfd >= 0 {
+		defer unix.Close(pidfd)
+	}
+	before, err := readProcStat(pid)
+	if err != nil {
+		return nil, 0, err
+	}
+	contents, err := readSmaps(pid)
+	if err != nil {
+		return nil, 0, err
+	}
+	after, err := readProcStat(pid)
+	if err != nil {
+		return nil, 0, err
+	}
+	if after.startTime != before.startTime || (pidfd >= 0 && !pidfdAlive(pidfd)) {
+		return nil, 0, fmt.Errorf("PID %d: %w", pid, errPidReused)
+	}
+	return parseSmaps(contents), before.startTime, nil
+}
+
+// reports whether reading a process failed because it exited, or because
+// its PID now belongs to another process
+func processExited(err error) bool {
+	return errors.Is(err, fs.ErrNotExist) || errors.Is(err, syscall.ESRCH) || errors.Is(err, errPidReused)
+}
+
+func printTrackUsage() {
+	fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s track [OPTION]... PID\n", os.Args[0])
+	fmt.Fprintf(flag.CommandLine.Output(), `Sample the mappings of a process repeatedly, and print mappings that grew,
+shrank, were created or were unmapped since the previous sample. When done,
+print the changes since the first sample.
+Options:
+  --help                %s
+  -w, --wide            %s
+  -h, --human-readable  %s
+  --interval            %s (default 10s)
+  --count               %s
+`,
+		flagHelpDescription,
+		flagWideDescription,
+		flagHumanReadableDescription,
+		flagIntervalDescription,
+		flagCountDescription)
+}
+
+func runTrack(args []string) int {
+	flags := flag.NewFlagSet("track", flag.ExitOnError)
+	var help, wideOutput, humanReadable bool
+	var interval time.Duration
+	var count int
+	flags.BoolVar(&help, "help", false, flagHelpDescription)
+	flags.BoolVar(&wideOutput, "wide", false, flagWideDescription)
+	flags.BoolVar(&wideOutput, "w", false, flagWideDescription)
+	flags.BoolVar(&humanReadable, "human-readable", false, flagHumanReadableDescription)
+	flags.BoolVar(&humanReadable, "h", false, flagHumanReadableDescription)
+	flags.DurationVar(&interval, "interval", 10*time.Second, flagIntervalDescription)
+	flags.IntVar(&count, "count", 0, flagCountDescription)
+	flags.Usage = printTrackUsage
+	flags.Parse(args)
+
+	if help {
+		printTrackUsage()
+		return ExitSuccess
+	}
+	if interval <= 0 || count < 0 {
+		fmt.Fprintf(os.Stderr, "error: interval must be positive and count not negative\n")
+		return ExitInvalidArguments
+	}
+	pids := parsePids(flags.Args())
+	if len(pids) != 1 {
+		fmt.Fprintf(os.Stderr, "error: track takes exactly one PID\n")
+		printTrackUsage()
+		return ExitInvalidArguments
+	}
+	pid := pids[0]
+
+	first, startTime, err := readTrackedMappings(pid)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return ExitFailure
+	}
+	started := time.Now()
+	fmt.Printf("%s tracking %d mappings of PID %d\n", started.Format(time.TimeOnly), len(first), pid)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	last := first
+	exitCode := ExitSuccess
+	for samples := 1; count == 0 || samples < count; samples++ {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+
+		mappings, start, err := readTrackedMappings(pid)
+		if processExited(err) || err == nil && start != startTime {
+			fmt.Printf("\n%s PID %d exited\n", time.Now().Format(time.TimeOnly), pid)
+			break
+		} else if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			exitCode = ExitFailure
+			break
+		}
+		if changes := diffMappings(last, mappings); len(changes) > 0 {
+			fmt.Printf("\n%s\n", time.Now().Format(time.TimeOnly))
+			renderMappingChanges(changes, wideOutput, humanReadable)
+		}
+		last = mappings
+	}
+
+	fmt.Printf("\nChanges since %s:\n", started.Format(time.TimeOnly))
+	renderMappingChanges(diffMappings(first, last), wideOutput, humanReadable)
+	return exitCode
+}
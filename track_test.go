@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"syscall"
+	"testing"
+)
+
+func testMapping(start, end uint64, path string, rss, privateDirty, swap int) Mapping {
+	return Mapping{start: start, end: end, perms: "rw-p", path: path, stats: map[string]int{
+		StatRSS:          rss,
+		StatPrivateDirty: privateDirty,
+		StatSwap:         swap,
+	}}
+}
+
+func TestDiffMappings(t *testing.T) {
+	before := []Mapping{
+		testMapping(0x400000, 0x401000, "/usr/bin/app", 4, 0, 0),
+		testMapping(0x1000000, 0x1200000, "[heap]", 1024, 1024, 0),
+		testMapping(0x7f0000100000, 0x7f0000200000, "/tmp/scratch", 256, 0, 0),
+		testMapping(0x7f0000800000, 0x7f0000900000, "", 512, 512, 64),
+		testMapping(0x7ffc00000000, 0x7ffc00021000, "[stack]", 132, 132, 0),
+	}
+	after := []Mapping{
+		testMapping(0x400000, 0x401000, "/usr/bin/app", 4, 0, 0),
+		// the heap grows up from its start
+		testMapping(0x1000000, 0x1400000, "[heap]", 3072, 3072, 0),
+		// a new library
+		testMapping(0x7f0000000000, 0x7f0000010000, "/usr/lib/libfoo.so", 40, 0, 0),
+		// /tmp/scratch was unmapped, and a new anonymous mapping merged with
+		// the one above it, growing down to a lower start
+		testMapping(0x7f0000700000, 0x7f0000900000, "", 600, 600, 0),
+		// part of the stack was swapped out
+		testMapping(0x7ffc00000000, 0x7ffc00021000, "[stack]", 100, 100, 32),
+	}
+
+	want := []struct {
+		start                   uint64
+		change                  string
+		rss, privateDirty, swap int
+	}{
+		{0x1000000, "grew", 2048, 2048, 0},
+		{0x7f0000000000, "new", 40, 0, 0},
+		{0x7f0000100000, "unmapped", -256, 0, 0},
+		{0x7f0000700000, "grew", 88, 88, -64},
+		{0x7ffc00000000, "shrank", -32, -32, 32},
+	}
+	changes := diffMappings(before, after)
+	if len(changes) != len(want) {
+		t.Fatalf("diffMappings = %d changes, want %d: %+v", len(changes), len(want), changes)
+	}
+	for i, change := range changes {
+		w := want[i]
+		if change.mapping.start != w.start || change.change != w.change ||
+			change.rss != w.rss || change.privateDirty != w.privateDirty || change.swap != w.swap {
+			t.Errorf("change %d = %x %s RSS %+d dirty %+d swap %+d, want %x %s %+d %+d %+d", i,
+				change.mapping.start, change.change, change.rss, change.privateDirty, change.swap,
+				w.start, w.change, w.rss, w.privateDirty, w.swap)
+		}
+	}
+	// unmapped mappings are shown as last seen
+	if changes[2].mapping.label() != "/tmp/scratch" || changes[2].mapping.RSS() != 256 {
+		t.Errorf("unmapped mapping = %+v, want /tmp/scratch as before", changes[2].mapping)
+	}
+}
+
+func TestDiffMappingsMatchesOnce(t *testing.T) {
+	// two anonymous mappings that could both match by start or end are
+	// each matched to one mapping
+	before := []Mapping{
+		testMapping(0x1000, 0x2000, "", 4, 4, 0),
+		testMapping(0x2000, 0x3000, "", 4, 4, 0),
+	}
+	after := []Mapping{
+		testMapping(0x1000, 0x2000, "", 4, 4, 0),
+		testMapping(0x2000, 0x3000, "", 4, 4, 0),
+	}
+	if changes := diffMappings(before, after); len(changes) != 0 {
+		t.Errorf("diffMappings of unchanged mappings = %+v, want none", changes)
+	}
+}
+
+func TestProcessExited(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{&fs.PathError{Op: "open", Path: "/proc/1234/smaps", Err: syscall.ENOENT}, true},
+		{&fs.PathError{Op: "read", Path: "/proc/1234/smaps", Err: syscall.ESRCH}, true},
+		{fmt.Errorf("PID 1234: %w", errPidReused), true},
+		{&fs.PathError{Op: "open", Path: "/proc/1234/smaps", Err: syscall.EACCES}, false},
+		{&fs.PathError{Op: "read", Path: "/proc/1234/smaps", Err: syscall.EIO}, false},
+		{nil, false},
+	}
+	for _, test := range tests {
+		if got := processExited(test.err); got != test.want {
+			t.Errorf("processExited(%v) = %v, want %v", test.err, got, test.want)
+		}
+	}
+}
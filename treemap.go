@@ -0,0 +1,155 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+)
+
+// a node of a treemap, its size being the sum of the sizes of its children
+type TreeNode struct {
+	name     string
+	size     int
+	children []*TreeNode
+}
+
+// adds size to the leaf at path, creating nodes as needed
+func (n *TreeNode) add(path []string, size int) {
+	n.size += size
+	if len(path) == 0 {
+		return
+	}
+	for _, child := range n.children {
+		if child.name == path[0] {
+			child.add(path[1:], size)
+			return
+		}
+	}
+	child := &TreeNode{name: path[0]}
+	n.children = append(n.children, child)
+	child.add(path[1:], size)
+}
+
+type Rect struct {
+	x, y, w, h float64
+}
+
+// how much a row of areas laid along side deviates from squares, see squarify
+func worstAspect(areas []float64, side float64) float64 {
+	sum, largest, smallest := 0.0, areas[0], areas[0]
+	for _, area := range areas {
+		sum += area
+		largest = max(largest, area)
+		smallest = min(smallest, area)
+	}
+	return max(side*side*largest/(sum*sum), sum*sum/(side*side*smallest))
+}
+
+// lays out positive values sorted in descending order as rectangles filling r,
+// with areas proportional to values and aspect ratios close to 1, using the
+// squarified treemap algorithm by Bruls, Huizing and van Wijk
+func squarify(values []float64, r Rect) []Rect {
+	rects := make([]Rect, len(values))
+	total := 0.0
+	for _, value := range values {
+		total += value
+	}
+	if total <= 0 || r.w <= 0 || r.h <= 0 {
+		return rects
+	}
+	areas := make([]float64, len(values))
+	for i, value := range values {
+		areas[i] = value * r.w * r.h / total
+	}
+
+	for start := 0; start < len(areas); {
+		side := min(r.w, r.h)
+		end := start + 1
+		for end < len(areas) && worstAspect(areas[start:end+1], side) <= worstAspect(areas[start:end], side) {
+			end++
+		}
+		sum := 0.0
+		for _, area := range areas[start:end] {
+			sum += area
+		}
+		if r.w >= r.h {
+			// a column along the left edge
+			width := sum / r.h
+			y := r.y
+			for i := start; i < end; i++ {
+				rects[i] = Rect{r.x, y, width, areas[i] / width}
+				y += rects[i].h
+			}
+			r.x += width
+			r.w -= width
+		} else {
+			// a row along the top edge
+			height := sum / r.w
+			x := r.x
+			for i := start; i < end; i++ {
+				rects[i] = Rect{x, r.y, areas[i] / height, height}
+				x += rects[i].w
+			}
+			r.y += height
+			r.h -= height
+		}
+		start = end
+	}
+	return rects
+}
+
+// a laid out treemap node, for rendering
+type TreemapRect struct {
+	X, Y, W, H float64
+	Label      string // shown if it fits
+	Title      string // tooltip, the path of the node and its size
+	Fill       string
+	Depth      int
+}
+
+const treemapLabelHeight = 14
+const treemapPadding = 2
+
+// lays out the children of root in r, with the children of each node nested
+// inside it below its label; each top level node gets its own hue
+func layoutTreemap(root *TreeNode, r Rect, humanReadable bool) []TreemapRect {
+	var rects []TreemapRect
+	var layout func(node *TreeNode, r Rect, path string, hue int, depth int)
+	layout = func(node *TreeNode, r Rect, path string, hue int, depth int) {
+		children := slices.DeleteFunc(slices.Clone(node.children), func(n *TreeNode) bool { return n.size <= 0 })
+		slices.SortFunc(children, func(a, b *TreeNode) int {
+			return cmp.Or(cmp.Compare(b.size, a.size), cmp.Compare(a.name, b.name))
+		})
+		values := make([]float64, len(children))
+		for i, child := range children {
+			values[i] = float64(child.size)
+		}
+		for i, cr := range squarify(values, r) {
+			child := children[i]
+			childPath := child.name
+			if path != "" {
+				childPath = path + " / " + child.name
+			}
+			childHue := hue
+			if depth == 0 {
+				childHue = i * 137 % 360 // golden angle, so neighbours differ
+			}
+			rect := TreemapRect{X: cr.x, Y: cr.y, W: cr.w, H: cr.h,
+				Title: childPath + ": " + kiloBytesToString(child.size, humanReadable),
+				Fill:  fmt.Sprintf("hsl(%d, 45%%, %d%%)", childHue, min(55+depth*10, 92)),
+				Depth: depth}
+			// about 6.5 pixels per character
+			if fits := int((cr.w - 6) / 6.5); fits >= 4 && cr.h > treemapLabelHeight {
+				rect.Label = truncateCommand(child.name, fits, false)
+			}
+			rects = append(rects, rect)
+
+			inner := Rect{cr.x + treemapPadding, cr.y + treemapLabelHeight, cr.w - 2*treemapPadding, cr.h - treemapLabelHeight - treemapPadding}
+			if len(child.children) > 0 && inner.w > 4 && inner.h > 4 {
+				layout(child, inner, childPath, childHue, depth+1)
+			}
+		}
+	}
+	layout(root, r, "", 0, 0)
+	return rects
+}
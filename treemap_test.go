@@ -0,0 +1,132 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+const epsilon = 1e-9
+
+func overlap(a, b Rect) bool {
+	return a.x+epsilon < b.x+b.w && b.x+epsilon < a.x+a.w &&
+		a.y+epsilon < b.y+b.h && b.y+epsilon < a.y+a.h
+}
+
+func inside(a, r Rect) bool {
+	return a.x >= r.x-epsilon && a.y >= r.y-epsilon &&
+		a.x+a.w <= r.x+r.w+epsilon && a.y+a.h <= r.y+r.h+epsilon
+}
+
+func TestSquarify(t *testing.T) {
+	tests := []struct {
+		values []float64
+		r      Rect
+	}{
+		// the example of Bruls, Huizing and van Wijk
+		{[]float64{6, 6, 4, 3, 2, 2, 1}, Rect{0, 0, 6, 4}},
+		{[]float64{6, 6, 4, 3, 2, 2, 1}, Rect{10, 20, 4, 6}},
+		{[]float64{100, 1, 1, 1}, Rect{0, 0, 800, 600}},
+		{[]float64{5}, Rect{0, 0, 3, 7}},
+		{[]float64{3, 3, 3, 3, 3, 3, 3, 3, 3}, Rect{0, 0, 300, 300}},
+	}
+	for _, test := range tests {
+		rects := squarify(test.values, test.r)
+		if len(rects) != len(test.values) {
+			t.Fatalf("squarify(%v) = %d rects", test.values, len(rects))
+		}
+		total := 0.0
+		for _, value := range test.values {
+			total += value
+		}
+		for i, rect := range rects {
+			want := test.values[i] * test.r.w * test.r.h / total
+			if math.Abs(rect.w*rect.h-want) > 1e-6 {
+				t.Errorf("squarify(%v) rect %d area = %v, want %v", test.values, i, rect.w*rect.h, want)
+			}
+			if !inside(rect, test.r) {
+				t.Errorf("squarify(%v) rect %d = %+v, outside %+v", test.values, i, rect, test.r)
+			}
+			for j := range i {
+				if overlap(rect, rects[j]) {
+					t.Errorf("squarify(%v) rects %d and %d overlap: %+v, %+v", test.values, j, i, rects[j], rect)
+				}
+			}
+		}
+	}
+
+	// the first row of the example: two 3 by 2 rectangles along the short side
+	rects := squarify([]float64{6, 6, 4, 3, 2, 2, 1}, Rect{0, 0, 6, 4})
+	if rects[0] != (Rect{0, 0, 3, 2}) || rects[1] != (Rect{0, 2, 3, 2}) {
+		t.Errorf("first row = %+v, %+v, want 3 by 2 at the left edge", rects[0], rects[1])
+	}
+	// equal values in a square make a grid of squares
+	for i, rect := range squarify([]float64{3, 3, 3, 3, 3, 3, 3, 3, 3}, Rect{0, 0, 300, 300}) {
+		if math.Abs(rect.w-100) > 1e-6 || math.Abs(rect.h-100) > 1e-6 {
+			t.Errorf("grid rect %d = %+v, want 100 by 100", i, rect)
+		}
+	}
+}
+
+func TestSquarifyEmpty(t *testing.T) {
+	for _, r := range []Rect{{0, 0, 0, 10}, {0, 0, 10, -1}} {
+		for _, rect := range squarify([]float64{1, 2}, r) {
+			if rect != (Rect{}) {
+				t.Errorf("squarify in %+v = %+v, want empty rects", r, rect)
+			}
+		}
+	}
+	if rects := squarify([]float64{0, 0}, Rect{0, 0, 10, 10}); rects[0] != (Rect{}) || rects[1] != (Rect{}) {
+		t.Errorf("squarify of zeros = %+v, want empty rects", rects)
+	}
+	if rects := squarify(nil, Rect{0, 0, 10, 10}); len(rects) != 0 {
+		t.Errorf("squarify(nil) = %+v", rects)
+	}
+}
+
+func TestTreeNodeAdd(t *testing.T) {
+	root := &TreeNode{}
+	root.add([]string{"postgres", "postgresql.service"}, 300)
+	root.add([]string{"postgres", "postgresql.service"}, 200)
+	root.add([]string{"postgres", "backup.service"}, 100)
+	root.add([]string{"root"}, 50)
+	if root.size != 650 || len(root.children) != 2 {
+		t.Fatalf("root = %d with %d children, want 650 with 2", root.size, len(root.children))
+	}
+	postgres := root.children[0]
+	if postgres.name != "postgres" || postgres.size != 600 || len(postgres.children) != 2 ||
+		postgres.children[0].size != 500 || postgres.children[1].size != 100 {
+		t.Errorf("postgres = %+v, want 600 in two units of 500 and 100", postgres)
+	}
+}
+
+func TestLayoutTreemap(t *testing.T) {
+	root := &TreeNode{}
+	root.add([]string{"postgres", "postgresql.service"}, 3000)
+	root.add([]string{"postgres", "backup.service"}, 1000)
+	root.add([]string{"root", "init.scope"}, 4000)
+	root.add([]string{"nobody"}, 0)
+	bounds := Rect{0, 0, 800, 600}
+	rects := layoutTreemap(root, bounds, false)
+
+	titles := map[string]TreemapRect{}
+	for _, rect := range rects {
+		titles[rect.Title] = rect
+		if !inside(Rect{rect.X, rect.Y, rect.W, rect.H}, bounds) {
+			t.Errorf("%s = %+v, outside the treemap", rect.Title, rect)
+		}
+	}
+	if len(rects) != 5 {
+		t.Fatalf("layoutTreemap = %d rects, want 5 without the empty node: %+v", len(rects), rects)
+	}
+	postgres, ok := titles["postgres: 4000"]
+	unit, ok2 := titles["postgres / postgresql.service: 3000"]
+	if !ok || !ok2 || postgres.Depth != 0 || unit.Depth != 1 {
+		t.Fatalf("rects = %v, want postgres with its units nested", titles)
+	}
+	if !inside(Rect{unit.X, unit.Y, unit.W, unit.H}, Rect{postgres.X, postgres.Y + treemapLabelHeight, postgres.W, postgres.H - treemapLabelHeight}) {
+		t.Errorf("unit %+v is not below the label of %+v", unit, postgres)
+	}
+	if postgres.Label != "postgres" || titles["root: 4000"].Fill == postgres.Fill {
+		t.Errorf("top level nodes %+v and %+v, want labels and different hues", postgres, titles["root: 4000"])
+	}
+}
@@ -0,0 +1,518 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/jedib0t/go-pretty/v6/text"
+	"golang.org/x/sys/unix"
+	"golang.org/x/term"
+)
+
+// processes sampled at one time, a screen of watch
+type Frame struct {
+	time      time.Time
+	processes []Process
+}
+
+// a frame per sample of a recording, from records in order of time
+func recordingFrames(records []Record) []Frame {
+	var frames []Frame
+	for i, record := range records {
+		if i == 0 || !record.Time.Equal(records[i-1].Time) {
+			frames = append(frames, Frame{time: record.Time})
+		}
+		frame := &frames[len(frames)-1]
+		frame.processes = append(frame.processes, record.Process())
+	}
+	return frames
+}
+
+// the fields of live mode, with the change of USS, PSS and RSS since the
+// previous frame before the command line
+func watchFields(previous map[ProcessKey]Process, options RenderOptions) []Field {
+	delta := func(name, header string, value func(Process) int) Field {
+		change := func(p Process) (int, bool) {
+			before, ok := previous[p.Key()]
+			if !ok || p.incomplete || before.incomplete {
+				return 0, false
+			}
+			return value(p) - value(before), true
+		}
+		return Field{name, header, text.AlignRight,
+			func(p Process) any {
+				if delta, ok := change(p); ok {
+					return delta
+				}
+				return nil
+			},
+			func(p Process) string {
+				delta, _ := change(p)
+				return deltaToString(delta, options.humanReadable)
+			}}
+	}
+	fields := outputFields(options)
+	command := fields[len(fields)-1]
+	return append(fields[:len(fields)-1],
+		delta("uss-delta", "ΔUSS", Process.USS),
+		delta("pss-delta", "ΔPSS", Process.PSS),
+		delta("rss-delta", "ΔRSS", Process.RSS),
+		command)
+}
+
+// try to infer terminal height, see terminalWidth
+func terminalHeight() int {
+	if _, height, err := term.GetSize(int(os.Stdout.Fd())); err == nil && height > 0 {
+		return height
+	}
+	if lines, err := strconv.Atoi(os.Getenv("LINES")); err == nil && lines > 0 {
+		return lines
+	}
+	return 24
+}
+
+// turns off line buffering and echo of the terminal, so that keys are read
+// as they are pressed, unlike term.MakeRaw keeping output processing and
+// signals such as ^C; returns a function restoring the previous state
+func enableCbreak(fd int) (func(), error) {
+	old, err := unix.IoctlGetTermios(fd, unix.TCGETS)
+	if err != nil {
+		return nil, err
+	}
+	cbreak := *old
+	cbreak.Lflag &^= unix.ICANON | unix.ECHO
+	cbreak.Cc[unix.VMIN] = 1
+	cbreak.Cc[unix.VTIME] = 0
+	if err := unix.IoctlSetTermios(fd, unix.TCSETS, &cbreak); err != nil {
+		return nil, err
+	}
+	return func() { unix.IoctlSetTermios(fd, unix.TCSETS, old) }, nil
+}
+
+// sends keys read from stdin, with arrow keys as "left" and "right"
+func readKeys(keys chan<- string) {
+	buf := make([]byte, 16)
+	for {
+		n, err := os.Stdin.Read(buf)
+		if err != nil {
+			close(keys)
+			return
+		}
+		switch input := string(buf[:n]); input {
+		case "\x1b[C", "\x1bOC":
+			keys <- "right"
+		case "\x1b[D", "\x1bOD":
+			keys <- "left"
+		default:
+			for _, r := range input {
+				keys <- string(r)
+			}
+		}
+	}
+}
+
+// sort keys cycled through with k
+var watchSortKeys = []string{"pid", "uss", "pss", "rss", "user", "command"}
+
+const maxLiveFrames = 1000
+
+// state of the watch screen
+type Watch struct {
+	frames   []Frame
+	position int
+	live     bool
+	interval time.Duration // of live sampling
+	playing  bool          // replay advances through frames, live follows new frames
+	speed    float64       // of replay
+	sortKey  string
+	reverse  bool
+	options  RenderOptions
+	where    *Expression // processes shown, all if nil
+	prompt   *string     // input of the jump prompt, while it is open
+	message  string      // shown until the next key
+}
+
+func (w *Watch) draw() {
+	var b strings.Builder
+	b.WriteString("\x1b[H\x1b[2J")
+
+	if len(w.frames) == 0 {
+		b.WriteString("collecting...\n")
+		os.Stdout.WriteString(b.String())
+		return
+	}
+	frame := w.frames[w.position]
+	state := "paused"
+	if w.playing && w.live {
+		state = "live, every " + w.interval.String()
+	} else if w.playing {
+		state = "playing at " + strconv.FormatFloat(w.speed, 'g', -1, 64) + "x"
+	}
+	fmt.Fprintf(&b, "psmaps watch  %s  sample %d/%d  %s\n",
+		frame.time.Local().Format(time.DateTime), w.position+1, len(w.frames), state)
+	lines := 1
+	if w.live {
+		if pressure, err := systemPressure(); err == nil {
+			fmt.Fprintf(&b, "memory pressure: %s\n", pressure)
+			lines++
+		}
+	}
+	order := w.sortKey
+	if w.reverse {
+		order += ", reversed"
+	}
+	switch {
+	case w.prompt != nil:
+		fmt.Fprintf(&b, "jump to (HH:MM:SS, YYYY-MM-DD HH:MM:SS, +1m or -1m): %s\n", *w.prompt)
+	case w.message != "":
+		fmt.Fprintf(&b, "%s\n", w.message)
+	default:
+		fmt.Fprintf(&b, "sorted by %s | q quit, space pause, ←/→ step, g jump, +/- speed, k sort key, r reverse\n", order)
+	}
+	lines++
+
+	previous := map[ProcessKey]Process{}
+	if w.position > 0 {
+		for _, process := range w.frames[w.position-1].processes {
+			previous[process.Key()] = process
+		}
+	}
+	processes := slices.Clone(frame.processes)
+	if w.where != nil {
+		var err error
+		if processes, err = filterProcesses(processes, w.where, outputFields(w.options)); err != nil {
+			fmt.Fprintf(&b, "error: --where: %v\n", err)
+			os.Stdout.WriteString(b.String())
+			return
+		}
+	}
+	sortProcesses(processes, w.sortKey, w.reverse)
+	// leave room for the table header and the cursor
+	processes = processes[:max(0, min(len(processes), terminalHeight()-lines-2))]
+	renderTable(&b, processes, watchFields(previous, w.options), w.options)
+	os.Stdout.WriteString(b.String())
+}
+
+// moves to the first frame at or after target, or the last one
+func (w *Watch) jump(target time.Time) {
+	w.position = len(w.frames) - 1
+	for i, frame := range w.frames {
+		if !frame.time.Before(target) {
+			w.position = i
+			return
+		}
+	}
+}
+
+// parses a time to jump to, relative to the current frame
+func (w *Watch) parseJump(input string) (time.Time, error) {
+	current := w.frames[w.position].time.Local()
+	input = strings.TrimSpace(input)
+	if strings.HasPrefix(input, "+") || strings.HasPrefix(input, "-") {
+		offset, err := time.ParseDuration(input)
+		return current.Add(offset), err
+	}
+	if t, err := time.ParseInLocation(time.DateTime, input, time.Local); err == nil {
+		return t, nil
+	}
+	for _, layout := range []string{time.TimeOnly, "15:04"} {
+		if t, err := time.ParseInLocation(layout, input, time.Local); err == nil {
+			return time.Date(current.Year(), current.Month(), current.Day(),
+				t.Hour(), t.Minute(), t.Second(), 0, time.Local), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time: %s", input)
+}
+
+// handles a key, reporting whether to quit
+func (w *Watch) key(key string) bool {
+	w.message = ""
+	if w.prompt != nil {
+		switch key {
+		case "\n", "\r":
+			if target, err := w.parseJump(*w.prompt); err != nil {
+				w.message = err.Error()
+			} else {
+				w.jump(target)
+				w.playing = false
+			}
+			w.prompt = nil
+		case "\x1b":
+			w.prompt = nil
+		case "\x7f", "\b":
+			if len(*w.prompt) > 0 {
+				*w.prompt = (*w.prompt)[:len(*w.prompt)-1]
+			}
+		default:
+			if len(key) == 1 && key[0] >= ' ' {
+				*w.prompt += key
+			}
+		}
+		return false
+	}
+
+	switch key {
+	case "q":
+		return true
+	case " ":
+		w.playing = !w.playing
+		if w.playing && w.live {
+			w.position = max(0, len(w.frames)-1)
+		}
+	case "right", "n", "l":
+		w.position = min(w.position+1, max(0, len(w.frames)-1))
+		w.playing = false
+	case "left", "p", "h":
+		w.position = max(w.position-1, 0)
+		w.playing = false
+	case "+":
+		w.speed = min(w.speed*2, 64)
+	case "-":
+		w.speed = max(w.speed/2, 0.125)
+	case "k":
+		i := slices.Index(watchSortKeys, strings.ToLower(w.sortKey))
+		w.sortKey = watchSortKeys[(i+1)%len(watchSortKeys)]
+	case "r":
+		w.reverse = !w.reverse
+	case "g":
+		if len(w.frames) > 0 {
+			prompt := ""
+			w.prompt = &prompt
+		}
+	}
+	return false
+}
+
+// adds a live frame, dropping the oldest beyond maxLiveFrames
+func (w *Watch) add(frame Frame) {
+	w.frames = append(w.frames, frame)
+	if len(w.frames) > maxLiveFrames {
+		w.frames = w.frames[1:]
+		w.position = max(w.position-1, 0)
+	}
+	if w.playing {
+		w.position = len(w.frames) - 1
+	}
+}
+
+// time until replay moves to the next frame, false if it does not
+func (w *Watch) nextFrame() (time.Duration, bool) {
+	if w.live || !w.playing || w.position >= len(w.frames)-1 {
+		return 0, false
+	}
+	gap := w.frames[w.position+1].time.Sub(w.frames[w.position].time)
+	return time.Duration(float64(gap) / w.speed), true
+}
+
+// samples processes every interval, sending frames until ctx is done
+func sampleFrames(ctx context.Context, pids []int, options CollectOptions, interval time.Duration, frames chan<- Frame) {
+	for {
+		selected := pids
+		if len(selected) == 0 {
+			selected = allProcesses()
+		}
+		sampled := time.Now()
+		processes := collectProcesses(ctx, selected, options)
+		resetCgroupMemory()
+		select {
+		case frames <- Frame{sampled, processes}:
+		case <-ctx.Done():
+			return
+		}
+		select {
+		case <-time.After(interval):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+const flagReplayDescription = "step through a recording instead of sampling"
+const flagSpeedDescription = "replay speed, relative to the recording"
+
+func printWatchUsage() {
+	fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s watch [OPTION]... [PID]...\n", os.Args[0])
+	fmt.Fprintf(flag.CommandLine.Output(), `Show memory of processes every interval, like top, with the change since the
+previous sample. With --replay, step through samples of recordings instead.
+Keys: q quit, space pause or play, left and right arrows (or p and n) step,
+g jump to a time, + and - change replay speed, k change sort key, r reverse.
+Options:
+  --help                %s
+  -w, --wide            %s
+  -k, --key             %s
+  -r, --reverse         %s
+  -h, --human-readable  %s
+  -j, --jobs            %s
+  -t, --timeout         %s
+  --interval            %s (default 2s)
+  --replay              %s (comma separated files)
+  --speed               %s (default 1)
+  --where               %s
+`,
+		flagHelpDescription,
+		flagWideDescription,
+		flagSortKeyDescription,
+		flagReverseSortDescription,
+		flagHumanReadableDescription,
+		flagJobsDescription,
+		flagTimeoutDescription,
+		flagIntervalDescription,
+		flagReplayDescription,
+		flagSpeedDescription,
+		flagWhereDescription)
+}
+
+func runWatch(args []string) int {
+	flags := flag.NewFlagSet("watch", flag.ExitOnError)
+	var help, wideOutput, reverseOrder, humanReadable bool
+	var sortKey, replay, where string
+	var jobs int
+	var timeout, interval time.Duration
+	var speed float64
+	flags.BoolVar(&help, "help", false, flagHelpDescription)
+	flags.BoolVar(&wideOutput, "wide", false, flagWideDescription)
+	flags.BoolVar(&wideOutput, "w", false, flagWideDescription)
+	flags.StringVar(&sortKey, "key", "pid", flagSortKeyDescription)
+	flags.StringVar(&sortKey, "k", "pid", flagSortKeyDescription)
+	flags.BoolVar(&reverseOrder, "reverse", false, flagReverseSortDescription)
+	flags.BoolVar(&reverseOrder, "r", false, flagReverseSortDescription)
+	flags.BoolVar(&humanReadable, "human-readable", false, flagHumanReadableDescription)
+	flags.BoolVar(&humanReadable, "h", false, flagHumanReadableDescription)
+	flags.IntVar(&jobs, "jobs", runtime.NumCPU(), flagJobsDescription)
+	flags.IntVar(&jobs, "j", runtime.NumCPU(), flagJobsDescription)
+	flags.DurationVar(&timeout, "timeout", 0, flagTimeoutDescription)
+	flags.DurationVar(&timeout, "t", 0, flagTimeoutDescription)
+	flags.DurationVar(&interval, "interval", 2*time.Second, flagIntervalDescription)
+	flags.StringVar(&replay, "replay", "", flagReplayDescription)
+	flags.Float64Var(&speed, "speed", 1, flagSpeedDescription)
+	flags.StringVar(&where, "where", "", flagWhereDescription)
+	flags.Usage = printWatchUsage
+	flags.Parse(args)
+
+	if help {
+		printWatchUsage()
+		return ExitSuccess
+	}
+	if !isSortKey(sortKey) {
+		fmt.Fprintf(os.Stderr, "error: unknown sort key: %s\n", sortKey)
+		return ExitInvalidArguments
+	}
+	if interval <= 0 || speed <= 0 {
+		fmt.Fprintf(os.Stderr, "error: interval and speed must be positive\n")
+		return ExitInvalidArguments
+	}
+
+	w := &Watch{
+		live:     replay == "",
+		interval: interval,
+		playing:  true,
+		speed:    speed,
+		sortKey:  sortKey,
+		reverse:  reverseOrder,
+		options:  RenderOptions{wide: wideOutput, humanReadable: humanReadable, format: OutputTable},
+	}
+	if where != "" {
+		var err error
+		if w.where, err = parseExpression(where, outputFields(w.options)); err != nil {
+			fmt.Fprintf(os.Stderr, "error: --where: %v\n", err)
+			return ExitInvalidArguments
+		}
+	}
+	var livePids []int
+	if w.live {
+		var err error
+		if livePids, err = parsePidArgs(flags.Args()); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			return ExitInvalidArguments
+		}
+	} else {
+		// recorded PIDs may since have been reused, so they are not resolved
+		pids := map[int]bool{}
+		for _, arg := range flags.Args() {
+			pid, err := strconv.Atoi(arg)
+			if err != nil || pid <= 0 {
+				fmt.Fprintf(os.Stderr, "error: invalid PID: %s\n", arg)
+				return ExitInvalidArguments
+			}
+			pids[pid] = true
+		}
+		records, err := readRecordings(strings.Split(replay, ","), pids)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			return ExitFailure
+		}
+		w.frames = recordingFrames(records)
+	}
+
+	restore, err := enableCbreak(int(os.Stdin.Fd()))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: watch requires a terminal: %v\n", err)
+		return ExitFailure
+	}
+	defer restore()
+	// alternate screen, without cursor
+	os.Stdout.WriteString("\x1b[?1049h\x1b[?25l")
+	defer os.Stdout.WriteString("\x1b[?25h\x1b[?1049l")
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	resized := make(chan os.Signal, 1)
+	signal.Notify(resized, syscall.SIGWINCH)
+	defer signal.Stop(resized)
+
+	keys := make(chan string)
+	go readKeys(keys)
+	frames := make(chan Frame)
+	if w.live {
+		go sampleFrames(ctx, livePids, CollectOptions{jobs: jobs, timeout: timeout}, interval, frames)
+	}
+
+	// the timer of the next replayed frame is only set again when the frame
+	// or the speed changes, so that keys and other events don't delay it
+	type schedule struct {
+		position int
+		speed    float64
+	}
+	var timer *time.Timer
+	var next <-chan time.Time
+	var scheduled schedule
+	for {
+		w.draw()
+
+		wait, ok := w.nextFrame()
+		if due := (schedule{w.position, w.speed}); !ok || next == nil || due != scheduled {
+			if timer != nil {
+				timer.Stop()
+			}
+			next = nil
+			if ok {
+				timer = time.NewTimer(wait)
+				next = timer.C
+				scheduled = due
+			}
+		}
+
+		select {
+		case key, ok := <-keys:
+			if !ok || w.key(key) {
+				return ExitSuccess
+			}
+		case frame := <-frames:
+			w.add(frame)
+		case <-next:
+			w.position++
+		case <-resized:
+		case <-ctx.Done():
+			return ExitSuccess
+		}
+	}
+}
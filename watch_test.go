@@ -0,0 +1,134 @@
+package main
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestRecordingFrames(t *testing.T) {
+	start := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	records := []Record{
+		{Time: start, PID: 1, PSS: 100},
+		{Time: start, PID: 2, PSS: 200},
+		{Time: start.Add(5 * time.Second), PID: 1, PSS: 110},
+		{Time: start.Add(10 * time.Second), PID: 1, PSS: 120},
+		{Time: start.Add(10 * time.Second), PID: 3, PSS: 300, Swap: 4},
+	}
+	frames := recordingFrames(records)
+	want := []struct {
+		offset time.Duration
+		pids   []int
+	}{
+		{0, []int{1, 2}},
+		{5 * time.Second, []int{1}},
+		{10 * time.Second, []int{1, 3}},
+	}
+	if len(frames) != len(want) {
+		t.Fatalf("recordingFrames = %d frames, want %d", len(frames), len(want))
+	}
+	for i, frame := range frames {
+		var pids []int
+		for _, process := range frame.processes {
+			pids = append(pids, process.PID())
+		}
+		if !frame.time.Equal(start.Add(want[i].offset)) || !slices.Equal(pids, want[i].pids) {
+			t.Errorf("frame %d = %v with PIDs %v, want %v with %v", i, frame.time, pids, start.Add(want[i].offset), want[i].pids)
+		}
+	}
+	if p := frames[2].processes[1]; p.PSS() != 300 || p.Swap() != 4 {
+		t.Errorf("replayed process = PSS %d, swap %d, want 300 and 4", p.PSS(), p.Swap())
+	}
+	if frames := recordingFrames(nil); len(frames) != 0 {
+		t.Errorf("recordingFrames(nil) = %v, want none", frames)
+	}
+}
+
+// a replay of frames every 10 seconds from 12:00:00 local time
+func testWatch(position int) *Watch {
+	start := time.Date(2026, 10, 18, 12, 0, 0, 0, time.Local)
+	w := &Watch{position: position, playing: true, speed: 1}
+	for i := range 10 {
+		w.frames = append(w.frames, Frame{time: start.Add(time.Duration(i) * 10 * time.Second)})
+	}
+	return w
+}
+
+func TestWatchParseJump(t *testing.T) {
+	at := func(clock string) time.Time {
+		t, _ := time.ParseInLocation(time.DateTime, "2026-10-18 "+clock, time.Local)
+		return t
+	}
+	tests := []struct {
+		input string
+		want  time.Time
+		err   bool
+	}{
+		{"-30s", at("12:00:20"), false},
+		{"+1m", at("12:01:50"), false},
+		{" +15s ", at("12:01:05"), false},
+		{"12:00:35", at("12:00:35"), false},
+		{"12:01", at("12:01:00"), false},
+		{"2026-10-17 23:59:59", time.Date(2026, 10, 17, 23, 59, 59, 0, time.Local), false},
+		{"+5x", time.Time{}, true},
+		{"noon", time.Time{}, true},
+		{"25:00", time.Time{}, true},
+	}
+	w := testWatch(5)
+	for _, test := range tests {
+		got, err := w.parseJump(test.input)
+		if test.err {
+			if err == nil {
+				t.Errorf("parseJump(%q) = %v, want an error", test.input, got)
+			}
+			continue
+		}
+		if err != nil || !got.Equal(test.want) {
+			t.Errorf("parseJump(%q) = %v, %v, want %v", test.input, got, err, test.want)
+		}
+	}
+}
+
+func TestWatchJump(t *testing.T) {
+	start := time.Date(2026, 10, 18, 12, 0, 0, 0, time.Local)
+	tests := []struct {
+		target   time.Time
+		position int
+	}{
+		{start.Add(-time.Hour), 0},
+		{start, 0},
+		{start.Add(30 * time.Second), 3},
+		// between frames, the next one
+		{start.Add(31 * time.Second), 4},
+		{start.Add(90 * time.Second), 9},
+		// beyond the recording, the last frame
+		{start.Add(time.Hour), 9},
+	}
+	for _, test := range tests {
+		w := testWatch(5)
+		w.jump(test.target)
+		if w.position != test.position {
+			t.Errorf("jump(%v) = frame %d, want %d", test.target.Format(time.TimeOnly), w.position, test.position)
+		}
+	}
+}
+
+func TestWatchJumpPrompt(t *testing.T) {
+	w := testWatch(0)
+	for _, key := range []string{"g", "1", "2", ":", "0", "1", "x", "\x7f", "\r"} {
+		if w.key(key) {
+			t.Fatalf("key %q quit", key)
+		}
+	}
+	if w.prompt != nil || w.message != "" || w.position != 6 || w.playing {
+		t.Errorf("after jumping to 12:01, prompt %v, message %q, frame %d, playing %v, want paused at frame 6",
+			w.prompt, w.message, w.position, w.playing)
+	}
+
+	for _, key := range []string{"g", "x", "\n"} {
+		w.key(key)
+	}
+	if w.message != "invalid time: x" || w.position != 6 {
+		t.Errorf("after an invalid time, message %q at frame %d, want an error at frame 6", w.message, w.position)
+	}
+}